@@ -3,9 +3,18 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"prom-logstash-exporter/constants"
+	"prom-logstash-exporter/pkg/collector"
+	"prom-logstash-exporter/pkg/discovery"
+	"prom-logstash-exporter/pkg/relabel"
+)
+
+var (
+	collectorFlags   = map[string]*bool{}
+	noCollectorFlags = map[string]*bool{}
 )
 
 var rootCmd = &cobra.Command{
@@ -30,4 +39,43 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().StringVar(&constants.LogstashURL, "logstash-url", "http://localhost:9600", "URL of the Logstash instance to monitor")
 	startCmd.PersistentFlags().StringVar(&constants.ListenAddress, "listen-address", ":2112", "The address to listen on for Prometheus metrics")
+	startCmd.PersistentFlags().DurationVar(&constants.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "Time given to in-flight scrapes to complete on SIGTERM or SIGINT before the exporter exits")
+	startCmd.PersistentFlags().StringVar(&constants.LogLevel, "log.level", "info", "Only log messages with the given severity or above: debug, info, warn or error")
+	startCmd.PersistentFlags().StringVar(&constants.LogFormat, "log.format", "logfmt", "Output format of the log messages: logfmt or json")
+	startCmd.PersistentFlags().StringArrayVar(&constants.DiscoveryFiles, "discovery.file", nil, "Repeatable path or glob of file_sd JSON/YAML files listing the Logstash targets to scrape instead of --logstash-url")
+	startCmd.PersistentFlags().DurationVar(&constants.DiscoveryFileRefreshInterval, "discovery.file.refresh-interval", 30*time.Second, "How often the --discovery.file files are checked for changes")
+	startCmd.PersistentFlags().StringArrayVar(&constants.DiscoveryDNSNames, "discovery.dns", nil, "Repeatable DNS name resolved to the Logstash targets to scrape instead of --logstash-url, e.g. _logstash._tcp.ls.internal")
+	startCmd.PersistentFlags().StringVar(&constants.DiscoveryDNSType, "discovery.dns.type", discovery.RecordSRV, "Type of the DNS records of --discovery.dns: SRV, A or AAAA")
+	startCmd.PersistentFlags().IntVar(&constants.DiscoveryDNSPort, "discovery.dns.port", 9600, "Port of the Logstash API of the targets resolved from A or AAAA records")
+	startCmd.PersistentFlags().DurationVar(&constants.DiscoveryDNSRefreshInterval, "discovery.dns.refresh-interval", 30*time.Second, "How often the --discovery.dns names are resolved")
+	startCmd.PersistentFlags().BoolVar(&constants.DiscoveryKubernetes, "discovery.kubernetes", false, "Scrape the Logstash pods found through the Kubernetes API instead of --logstash-url")
+	startCmd.PersistentFlags().StringVar(&constants.DiscoveryKubernetesAPIServer, "discovery.kubernetes.api-server", "", "URL of the Kubernetes API server, e.g. of kubectl proxy (default: in-cluster configuration)")
+	startCmd.PersistentFlags().StringVar(&constants.DiscoveryKubernetesNamespace, "discovery.kubernetes.namespace", "", "Namespace of the Logstash pods (default: all namespaces)")
+	startCmd.PersistentFlags().StringVar(&constants.DiscoveryKubernetesLabelSelector, "discovery.kubernetes.label-selector", "app=logstash", "Label selector of the Logstash pods")
+	startCmd.PersistentFlags().StringVar(&constants.DiscoveryKubernetesPortName, "discovery.kubernetes.port-name", "monitoring", "Name of the container port of the Logstash API")
+	startCmd.PersistentFlags().DurationVar(&constants.DiscoveryKubernetesRefreshInterval, "discovery.kubernetes.refresh-interval", 30*time.Second, "How often the watched Logstash pods are listed again")
+	startCmd.PersistentFlags().DurationVar(&constants.ScrapeTimeout, "scrape-timeout", 10*time.Second, "Timeout of a Logstash scrape, retries included")
+	startCmd.PersistentFlags().IntVar(&constants.ScrapeConcurrency, "scrape-concurrency", 10, "Maximum number of targets scraped at once when scraping discovered targets (0 for no limit)")
+	startCmd.PersistentFlags().IntVar(&constants.RetryAttempts, "retry-attempts", 2, "Number of retries of a failed Logstash request within the scrape timeout (0 disables retries)")
+	startCmd.PersistentFlags().DurationVar(&constants.RetryBackoff, "retry-backoff", 250*time.Millisecond, "Base delay before retrying a failed Logstash request, doubled and jittered on every retry")
+	startCmd.PersistentFlags().IntVar(&constants.CircuitBreakerThreshold, "circuit-breaker-threshold", 0, "Number of consecutive failed scrapes after which Logstash is considered down (0 disables the circuit breaker)")
+	startCmd.PersistentFlags().DurationVar(&constants.CircuitBreakerCooldown, "circuit-breaker-cooldown", 30*time.Second, "How long scrapes of a Logstash considered down are short-circuited")
+	startCmd.PersistentFlags().BoolVar(&constants.LegacyMetricNames, "legacy-metric-names", false, "Expose metrics renamed to follow the Prometheus naming conventions under their former names")
+	startCmd.PersistentFlags().BoolVar(&constants.StatusStateSet, "status-state-set", false, "Expose logstash_status as a state set labeled by status instead of a status code")
+	startCmd.PersistentFlags().StringArrayVar(&constants.ConstLabels, "label", nil, "Repeatable name=value label attached to every metric, e.g. --label cluster=prod")
+	startCmd.PersistentFlags().BoolVar(&constants.AggregateEndpoint, "aggregate-endpoint", false, "Serve pipeline counters and worker utilization and heap usage aggregated across all targets on /metrics/aggregate")
+	startCmd.PersistentFlags().StringVar(&constants.MetricsProfile, "metrics.profile", relabel.ProfileNative, fmt.Sprintf("Metric naming profile, one of %v, mapping metric names to those of other Logstash exporters", relabel.ProfileNames()))
+	startCmd.PersistentFlags().StringVar(&constants.MetricRelabelConfigFile, "metric-relabel-config", "", "YAML file of metric_relabel_configs renaming, dropping or relabeling metrics before they are exposed")
+	for _, name := range collector.CollectorNames {
+		collectorFlags[name] = startCmd.PersistentFlags().Bool("collector."+name, true, fmt.Sprintf("Enable the %s collector", name))
+		noCollectorFlags[name] = startCmd.PersistentFlags().Bool("no-collector."+name, false, fmt.Sprintf("Disable the %s collector", name))
+	}
+	startCmd.PersistentFlags().StringArrayVar(&constants.PipelineInclude, "pipeline-include", nil, "Repeatable regular expression of the pipeline names to export (default: all pipelines)")
+	startCmd.PersistentFlags().StringArrayVar(&constants.PipelineExclude, "pipeline-exclude", nil, "Repeatable regular expression of the pipeline names not to export")
+	startCmd.PersistentFlags().StringArrayVar(&constants.PluginInclude, "plugin-include", nil, "Repeatable regular expression of the plugin IDs or names to export (default: all plugins)")
+	startCmd.PersistentFlags().StringArrayVar(&constants.PluginExclude, "plugin-exclude", nil, "Repeatable regular expression of the plugin IDs or names not to export")
+	startCmd.PersistentFlags().IntVar(&constants.MaxPluginSeries, "max-plugin-series", 0, "Maximum number of plugin series exposed per scrape (0 disables the limit)")
+	startCmd.PersistentFlags().BoolVar(&constants.ReplaceGeneratedIDs, "replace-generated-plugin-ids", false, "Label plugins with a Logstash-generated ID by their name and position instead")
+	startCmd.PersistentFlags().BoolVar(&constants.PluginMetrics, "plugin-metrics", false, "Expose plugin-specific numeric fields as logstash_pipeline_plugin_metric")
+	startCmd.PersistentFlags().StringSliceVar(&constants.PluginMetricKeys, "plugin-metric-keys", nil, "Keys exported as logstash_pipeline_plugin_metric, e.g. bulk_requests.with_errors. When empty, every numeric key of every plugin is exported, one series per key and plugin: set it or --max-plugin-series on large pipelines")
 }
@@ -1,16 +1,24 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"log"
+	"net"
 	"net/http"
+	"os/signal"
 	"prom-logstash-exporter/constants"
 	"prom-logstash-exporter/pkg/collector"
+	"prom-logstash-exporter/pkg/collector/node_stats"
+	"prom-logstash-exporter/pkg/discovery"
+	"prom-logstash-exporter/pkg/helpers"
+	"prom-logstash-exporter/pkg/relabel"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -19,19 +27,110 @@ var startCmd = &cobra.Command{
 	Short: "Start the Logstash exporter",
 	Long:  "Start the Prometheus Logstash exporter with the specified configuration.",
 	Run: func(cmd *cobra.Command, args []string) {
+		configureLogging()
 		startExporter(constants.LogstashURL, constants.ListenAddress)
 	},
 }
 
+// startExporter serves the metrics until SIGTERM or SIGINT is received, then
+// stops target discovery and lets in-flight requests complete within the
+// --shutdown-timeout before returning.
 func startExporter(logstashURL, listenAddress string) {
-	logstashCollector, err := collector.NewLogstashCollector(logstashURL)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	pipelinesFilter, err := newPipelinesFilter()
+	if err != nil {
+		logrus.WithError(err).Fatalln("Invalid pipeline or plugin filter")
+	}
+
+	constLabels, err := helpers.ParseLabels(constants.ConstLabels)
 	if err != nil {
-		logrus.Fatalf("Cannot register a new collector: %v", err)
+		logrus.WithError(err).Fatalln("Invalid label")
+	}
+
+	relabelConfigs, err := relabel.Profile(constants.MetricsProfile)
+	if err != nil {
+		logrus.WithError(err).Fatalln("Invalid metrics profile")
+	}
+	if constants.MetricRelabelConfigFile != "" {
+		fileConfigs, err := relabel.LoadFile(constants.MetricRelabelConfigFile)
+		if err != nil {
+			logrus.WithError(err).Fatalln("Invalid metric relabel config")
+		}
+		relabelConfigs = append(relabelConfigs, fileConfigs...)
+	}
+
+	options := collector.Options{
+		Client: collector.ClientOptions{
+			Timeout:                 constants.ScrapeTimeout,
+			RetryAttempts:           constants.RetryAttempts,
+			RetryBackoff:            constants.RetryBackoff,
+			CircuitBreakerThreshold: constants.CircuitBreakerThreshold,
+			CircuitBreakerCooldown:  constants.CircuitBreakerCooldown,
+		},
+		Pipelines: node_stats.PipelinesCollectorOptions{
+			PluginMetrics:       constants.PluginMetrics,
+			PluginMetricKeys:    constants.PluginMetricKeys,
+			Filter:              pipelinesFilter,
+			MaxPluginSeries:     constants.MaxPluginSeries,
+			ReplaceGeneratedIDs: constants.ReplaceGeneratedIDs,
+		},
+		Collectors:        enabledCollectors(),
+		StatusStateSet:    constants.StatusStateSet,
+		ConstLabels:       constLabels,
+		LegacyMetricNames: constants.LegacyMetricNames,
+	}
+
+	var logstashCollector selectableCollector
+	var discoveries sync.WaitGroup
+	if discoverers := newDiscoverers(); len(discoverers) > 0 {
+		targets, err := collector.NewTargets(options, constants.ScrapeConcurrency)
+		if err != nil {
+			logrus.WithError(err).Fatalln("Cannot register a new collector")
+		}
+		for _, d := range discoverers {
+			d := d
+			discoveries.Add(1)
+			go func() {
+				defer discoveries.Done()
+				discovery.Run(ctx, d.name, d.discoverer, d.interval, func(discovered []discovery.Target) {
+					targets.Sync(d.name, discovered)
+				})
+			}()
+		}
+		logstashCollector = targets
+	} else {
+		logstashCollector, err = collector.NewLogstashCollector(logstashURL, options)
+		if err != nil {
+			logrus.WithError(err).Fatalln("Cannot register a new collector")
+		}
+	}
+	var registered prometheus.Collector = logstashCollector
+	var recorder *collector.Recorder
+	if constants.AggregateEndpoint {
+		recorder = collector.NewRecorder(logstashCollector)
+		registered = recorder
+	}
+	if err := prometheus.Register(registered); err != nil {
+		logrus.WithError(err).Fatalln("Cannot register the Logstash collector")
+	}
+	if err := prometheus.WrapRegistererWith(constLabels, prometheus.DefaultRegisterer).Register(version.NewCollector("prom_logstash_exporter")); err != nil {
+		logrus.WithError(err).Fatalln("Cannot register the version collector")
 	}
-	prometheus.MustRegister(logstashCollector)
-	prometheus.MustRegister(version.NewCollector("prom_logstash_exporter"))
 
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", metricsHandler(logstashCollector, relabelConfigs))
+	if constants.AggregateEndpoint {
+		aggregate, err := collector.NewAggregate(recorder, helpers.Naming{Legacy: constants.LegacyMetricNames}, constLabels)
+		if err != nil {
+			logrus.WithError(err).Fatalln("Cannot register the aggregate collector")
+		}
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(aggregate); err != nil {
+			logrus.WithError(err).Fatalln("Cannot register the aggregate collector")
+		}
+		http.Handle("/metrics/aggregate", promhttp.HandlerFor(registry, metricsHandlerOpts))
+	}
 	http.HandleFunc("/-/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -48,16 +147,208 @@ func startExporter(logstashURL, listenAddress string) {
 
 		err := json.NewEncoder(w).Encode(response)
 		if err != nil {
-			log.Printf("Health check write response error: %v", err)
+			logrus.WithError(err).Warnln("Health check write response error")
 		}
 	})
 
-	logrus.Info("prom-logstash-exporter version: ", constants.Version)
-	logrus.Printf("Logstash exporter is running on %s...", listenAddress)
+	logrus.WithFields(logrus.Fields{"version": constants.Version, "address": listenAddress}).Infoln("Logstash exporter is running")
+
+	// A second signal kills the exporter instead of waiting for the shutdown.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		logrus.WithError(err).Fatalln("Error starting the HTTP server")
+	}
+	if err := serve(ctx, &http.Server{}, listener, constants.ShutdownTimeout, &discoveries, logstashCollector); err != nil {
+		logrus.WithError(err).Fatalln("Error starting the HTTP server")
+	}
+	logrus.Infoln("Logstash exporter stopped")
+}
+
+// serve runs server on listener until ctx is done. It then stops accepting
+// connections, gives in-flight requests up to timeout to complete, waits for
+// discoveries to stop and closes the collector.
+func serve(ctx context.Context, server *http.Server, listener net.Listener, timeout time.Duration, discoveries *sync.WaitGroup, logstashCollector selectableCollector) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logrus.WithField("timeout", timeout).Infoln("Shutting down, waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logrus.WithError(err).Warnln("In-flight requests did not complete before the shutdown timeout")
+	}
+
+	discoveries.Wait()
+	logstashCollector.Close()
+	return nil
+}
+
+// configureLogging applies the --log.level and --log.format flags to the
+// standard logger.
+func configureLogging() {
+	level, err := logrus.ParseLevel(constants.LogLevel)
+	if err != nil {
+		logrus.WithError(err).Fatalln("Invalid log level")
+	}
+	logrus.SetLevel(level)
+
+	switch constants.LogFormat {
+	case "logfmt":
+		logrus.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		logrus.WithField("format", constants.LogFormat).Fatalln("Invalid log format: must be logfmt or json")
+	}
+}
+
+var metricsHandlerOpts = promhttp.HandlerOpts{
+	ErrorLog:      logrus.StandardLogger(),
+	ErrorHandling: promhttp.ContinueOnError,
+}
+
+// selectableCollector is a collector whose collectors can be selected with the
+// collect[] query parameter.
+type selectableCollector interface {
+	prometheus.Collector
+	Select(names []string) (prometheus.Collector, error)
+	Close()
+}
+
+// metricsHandler serves the default registry, or only the collectors listed in
+// the collect[] query parameter when it is set, applying relabelConfigs to the
+// gathered metrics.
+func metricsHandler(logstashCollector selectableCollector, relabelConfigs []*relabel.Config) http.Handler {
+	gatherer := func(g prometheus.Gatherer) prometheus.Gatherer {
+		if len(relabelConfigs) == 0 {
+			return g
+		}
+		return &relabel.Gatherer{Gatherer: g, Configs: relabelConfigs}
+	}
+
+	defaultHandler := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(gatherer(prometheus.DefaultGatherer), metricsHandlerOpts))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names := r.URL.Query()["collect[]"]
+		if len(names) == 0 {
+			defaultHandler.ServeHTTP(w, r)
+			return
+		}
+
+		selected, err := logstashCollector.Select(names)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(selected)
+		promhttp.HandlerFor(gatherer(registry), metricsHandlerOpts).ServeHTTP(w, r)
+	})
+}
+
+// newPipelinesFilter compiles the --pipeline-include/exclude and --plugin-include/exclude flags.
+func newPipelinesFilter() (node_stats.PipelinesFilter, error) {
+	var filter node_stats.PipelinesFilter
+	var err error
+
+	if filter.PipelineInclude, err = helpers.CompileAnchoredRegexps(constants.PipelineInclude); err != nil {
+		return filter, err
+	}
+	if filter.PipelineExclude, err = helpers.CompileAnchoredRegexps(constants.PipelineExclude); err != nil {
+		return filter, err
+	}
+	if filter.PluginInclude, err = helpers.CompileAnchoredRegexps(constants.PluginInclude); err != nil {
+		return filter, err
+	}
+	if filter.PluginExclude, err = helpers.CompileAnchoredRegexps(constants.PluginExclude); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+type namedDiscoverer struct {
+	name       string
+	discoverer discovery.Discoverer
+	interval   time.Duration
+}
+
+// newDiscoverers returns the target discoverers configured with the --discovery.* flags.
+func newDiscoverers() []namedDiscoverer {
+	var discoverers []namedDiscoverer
+	if len(constants.DiscoveryFiles) > 0 {
+		discoverers = append(discoverers, namedDiscoverer{
+			name:       "file",
+			discoverer: &discovery.FileDiscoverer{Patterns: constants.DiscoveryFiles},
+			interval:   constants.DiscoveryFileRefreshInterval,
+		})
+	}
+	if len(constants.DiscoveryDNSNames) > 0 {
+		switch constants.DiscoveryDNSType {
+		case discovery.RecordSRV, discovery.RecordA, discovery.RecordAAAA:
+		default:
+			logrus.WithField("type", constants.DiscoveryDNSType).Fatalln("Invalid DNS record type: must be one of SRV, A or AAAA")
+		}
+		discoverers = append(discoverers, namedDiscoverer{
+			name: "dns",
+			discoverer: &discovery.DNSDiscoverer{
+				Names: constants.DiscoveryDNSNames,
+				Type:  constants.DiscoveryDNSType,
+				Port:  constants.DiscoveryDNSPort,
+			},
+			interval: constants.DiscoveryDNSRefreshInterval,
+		})
+	}
+	if constants.DiscoveryKubernetes {
+		discoverers = append(discoverers, namedDiscoverer{
+			name: "kubernetes",
+			discoverer: &discovery.KubernetesDiscoverer{
+				Lister:        newPodLister(),
+				Namespace:     constants.DiscoveryKubernetesNamespace,
+				LabelSelector: constants.DiscoveryKubernetesLabelSelector,
+				PortName:      constants.DiscoveryKubernetesPortName,
+			},
+			interval: constants.DiscoveryKubernetesRefreshInterval,
+		})
+	}
+	return discoverers
+}
+
+// newPodLister returns the client of --discovery.kubernetes.api-server, or of
+// the cluster the exporter runs in when unset.
+func newPodLister() discovery.PodLister {
+	if constants.DiscoveryKubernetesAPIServer != "" {
+		return &discovery.APIPodLister{Server: constants.DiscoveryKubernetesAPIServer}
+	}
+
+	lister, err := discovery.NewInClusterPodLister()
+	if err != nil {
+		logrus.WithError(err).Fatalln("Cannot configure Kubernetes discovery")
+	}
+	return lister
+}
 
-	if err := http.ListenAndServe(listenAddress, nil); err != nil {
-		logrus.Fatalf("Error starting the HTTP server: %v", err)
+// enabledCollectors resolves the --collector.<name> and --no-collector.<name> flags.
+func enabledCollectors() collector.Selection {
+	collectors := collector.Selection{}
+	for _, name := range collector.CollectorNames {
+		collectors[name] = *collectorFlags[name] && !*noCollectorFlags[name]
 	}
+	return collectors
 }
 
 func init() {
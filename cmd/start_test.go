@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"prom-logstash-exporter/pkg/collector"
+)
+
+// closeRecorder records when the collector is closed among the events of the
+// test.
+type closeRecorder struct {
+	*collector.Collector
+	record func(event string)
+}
+
+func (c closeRecorder) Close() {
+	c.record("close")
+	c.Collector.Close()
+}
+
+// TestServeCompletesInFlightScrapes cancels the context while a scrape waits
+// for Logstash: the response must still be delivered, and the collector only
+// closed afterwards.
+func TestServeCompletesInFlightScrapes(t *testing.T) {
+	scraping := make(chan struct{})
+	release := make(chan struct{})
+	logstash := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(scraping)
+		<-release
+		_, _ = w.Write([]byte(`{"status": "green"}`))
+	}))
+	defer logstash.Close()
+
+	var mutex sync.Mutex
+	var events []string
+	record := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+
+	c, err := collector.NewLogstashCollector(logstash.URL, collector.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+		record("response")
+	})}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var discoveries sync.WaitGroup
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, server, listener, 10*time.Second, &discoveries, closeRecorder{c, record})
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	scraped := make(chan result, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+		if err != nil {
+			scraped <- result{err: err}
+			return
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		scraped <- result{string(body), err}
+	}()
+
+	select {
+	case <-scraping:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Logstash was not scraped")
+	}
+	cancel()
+
+	// The shutdown waits for the scrape blocked on Logstash.
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned during an in-flight scrape: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	select {
+	case r := <-scraped:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if !strings.Contains(r.body, "logstash_up 1") {
+			t.Errorf("scrape response does not report logstash_up 1:\n%s", r.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the in-flight scrape was not answered")
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the in-flight scrape")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if want := []string{"response", "close"}; strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	// New scrapes are refused once shut down.
+	if _, err := http.Get("http://" + listener.Addr().String() + "/metrics"); err == nil {
+		t.Error("the server still accepts scrapes after the shutdown")
+	}
+}
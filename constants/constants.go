@@ -5,8 +5,65 @@ import "time"
 const Version = "v1.0.0"
 
 var (
-	LogstashURL   string
-	ListenAddress string
+	LogstashURL      string
+	ListenAddress    string
+	PluginMetrics    bool
+	PluginMetricKeys []string
+	StatusStateSet   bool
+	PipelineInclude  []string
+	PipelineExclude  []string
+	PluginInclude    []string
+	PluginExclude    []string
+
+	// LogLevel and LogFormat configure the exporter logs, see the --log.level and --log.format flags.
+	LogLevel  string
+	LogFormat string
+
+	// ShutdownTimeout bounds the time in-flight requests are given to complete on shutdown.
+	ShutdownTimeout time.Duration
+
+	// ConstLabels holds the name=value labels attached to every metric.
+	ConstLabels []string
+
+	// MetricsProfile names the metric naming profile, see relabel.ProfileNames.
+	MetricsProfile string
+	// MetricRelabelConfigFile is the YAML file of the metric_relabel_configs applied before exposition.
+	MetricRelabelConfigFile string
+
+	// AggregateEndpoint serves the metrics aggregated across targets on /metrics/aggregate.
+	AggregateEndpoint bool
+
+	MaxPluginSeries     int
+	ReplaceGeneratedIDs bool
+
+	// DiscoveryFiles, DiscoveryDNSNames and DiscoveryKubernetes configure target
+	// discovery, multi-target mode being enabled when any is set.
+	DiscoveryFiles               []string
+	DiscoveryFileRefreshInterval time.Duration
+	DiscoveryDNSNames            []string
+	DiscoveryDNSType             string
+	DiscoveryDNSPort             int
+	DiscoveryDNSRefreshInterval  time.Duration
+
+	DiscoveryKubernetes                bool
+	DiscoveryKubernetesAPIServer       string
+	DiscoveryKubernetesNamespace       string
+	DiscoveryKubernetesLabelSelector   string
+	DiscoveryKubernetesPortName        string
+	DiscoveryKubernetesRefreshInterval time.Duration
+
+	// ScrapeConcurrency bounds the number of targets scraped at once in multi-target mode.
+	ScrapeConcurrency int
+
+	ScrapeTimeout           time.Duration
+	RetryAttempts           int
+	RetryBackoff            time.Duration
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+
+	// LegacyMetricNames keeps the metric names used before they were renamed
+	// to follow the Prometheus naming conventions.
+	LegacyMetricNames bool
 )
 
 const (
@@ -0,0 +1,231 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"math"
+	"prom-logstash-exporter/constants"
+	"prom-logstash-exporter/pkg/helpers"
+	"sort"
+	"sync"
+)
+
+// aggregations are the values of the aggregation label of the gauges aggregated across targets.
+var aggregations = []string{"min", "max", "avg"}
+
+// Recorder forwards the metrics of a collector and keeps those of its last
+// collect, so that they can be aggregated without scraping the targets again.
+type Recorder struct {
+	prometheus.Collector
+
+	mutex   sync.Mutex
+	metrics []prometheus.Metric
+}
+
+func NewRecorder(source prometheus.Collector) *Recorder {
+	return &Recorder{Collector: source}
+}
+
+func (r *Recorder) Collect(ch chan<- prometheus.Metric) {
+	forward := make(chan prometheus.Metric, 64)
+	recorded := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for metric := range forward {
+			metrics = append(metrics, metric)
+			ch <- metric
+		}
+		recorded <- metrics
+	}()
+
+	r.Collector.Collect(forward)
+	close(forward)
+	metrics := <-recorded
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metrics = metrics
+}
+
+// lastCollect sends the metrics recorded during the last collect of a Recorder.
+type lastCollect struct {
+	recorder *Recorder
+}
+
+// Describe sends no descriptor: the recorded metrics are only checked when
+// they are collected by the source, so lastCollect is an unchecked collector.
+func (l lastCollect) Describe(chan<- *prometheus.Desc) {}
+
+func (l lastCollect) Collect(ch chan<- prometheus.Metric) {
+	l.recorder.mutex.Lock()
+	metrics := l.recorder.metrics
+	l.recorder.mutex.Unlock()
+
+	for _, metric := range metrics {
+		ch <- metric
+	}
+}
+
+// Aggregate collects fleet-wide series computed from the metrics of every
+// target recorded during the last collect of a Recorder: pipeline counters
+// summed across the targets sharing a pipeline name, and the spread of worker
+// utilization and heap usage. Nothing is scraped by collecting an Aggregate:
+// the series are as old as the last collect of the Recorder, and before it only
+// the target counts are sent, both 0.
+//
+// The sums are gauges rather than counters: they decrease when a target goes
+// away, which rate() would take for a counter reset.
+type Aggregate struct {
+	registry *prometheus.Registry
+	naming   helpers.Naming
+
+	targets           *prometheus.Desc
+	targetsUp         *prometheus.Desc
+	eventIn           *prometheus.Desc
+	eventOut          *prometheus.Desc
+	droppedEvents     *prometheus.Desc
+	workerUtilization *prometheus.Desc
+	heapUsed          *prometheus.Desc
+}
+
+// NewAggregate returns the aggregate of the metrics recorded by source, whose
+// metrics are named with naming.
+func NewAggregate(source *Recorder, naming helpers.Naming, constLabels prometheus.Labels) (*Aggregate, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(lastCollect{recorder: source}); err != nil {
+		return nil, err
+	}
+
+	desc := naming.NewDescFQ(constants.Namespace, "aggregate", constLabels)
+	return &Aggregate{
+		registry:          registry,
+		naming:            naming,
+		targets:           desc("targets", "The number of scraped targets."),
+		targetsUp:         desc("targets_up", "The number of targets successfully scraped."),
+		eventIn:           desc("pipeline_events_in", "The total number of events in, summed across the targets running the pipeline. Decreases when a target goes away.", "pipeline"),
+		eventOut:          desc("pipeline_events_out", "The total number of events out, summed across the targets running the pipeline. Decreases when a target goes away.", "pipeline"),
+		droppedEvents:     desc("pipeline_dead_letter_queue_dropped_events", "The total number of events dropped by the dead letter queue, summed across the targets running the pipeline. Decreases when a target goes away.", "pipeline"),
+		workerUtilization: desc("pipeline_worker_utilization_ratio", "The min, max or avg worker utilization ratio of the pipeline across the targets running it.", "pipeline", "aggregation"),
+		heapUsed:          desc("jvm_heap_used_ratio", "The min, max or avg JVM heap usage ratio across the targets.", "aggregation"),
+	}, nil
+}
+
+func (a *Aggregate) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.targets
+	ch <- a.targetsUp
+	ch <- a.eventIn
+	ch <- a.eventOut
+	ch <- a.droppedEvents
+	ch <- a.workerUtilization
+	ch <- a.heapUsed
+}
+
+func (a *Aggregate) Collect(ch chan<- prometheus.Metric) {
+	families, err := a.registry.Gather()
+	if err != nil {
+		logrus.WithError(err).Warnln("Aggregating partially gathered metrics")
+	}
+
+	values := make(map[string][]*dto.Metric, len(families))
+	for _, family := range families {
+		values[family.GetName()] = family.GetMetric()
+	}
+	name := func(subsystem, name string) []*dto.Metric {
+		return values[a.naming.BuildFQName(constants.Namespace, subsystem, name)]
+	}
+
+	up := name("", "up")
+	a.send(ch, a.targets, prometheus.GaugeValue, float64(len(up)))
+	a.send(ch, a.targetsUp, prometheus.GaugeValue, sum(up))
+
+	for _, total := range []struct {
+		desc    *prometheus.Desc
+		metrics []*dto.Metric
+	}{
+		{a.eventIn, name("pipeline", "event_in_total")},
+		{a.eventOut, name("pipeline", "event_out_total")},
+		{a.droppedEvents, name("pipeline", "dead_letter_queue_dropped_events_total")},
+	} {
+		byPipeline := groupByPipeline(total.metrics)
+		for _, pipeline := range sortedKeys(byPipeline) {
+			a.send(ch, total.desc, prometheus.GaugeValue, sum(byPipeline[pipeline]), pipeline)
+		}
+	}
+
+	byPipeline := groupByPipeline(name("pipeline", "worker_utilization_ratio"))
+	for _, pipeline := range sortedKeys(byPipeline) {
+		a.sendSpread(ch, a.workerUtilization, byPipeline[pipeline], pipeline)
+	}
+
+	a.sendSpread(ch, a.heapUsed, name("jvm", "heap_used_ratio"))
+}
+
+// sendSpread sends the min, max and avg of the values of metrics, nothing when there is none.
+func (a *Aggregate) sendSpread(ch chan<- prometheus.Metric, desc *prometheus.Desc, metrics []*dto.Metric, labels ...string) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, m := range metrics {
+		v := value(m)
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+
+	for i, v := range []float64{min, max, sum(metrics) / float64(len(metrics))} {
+		a.send(ch, desc, prometheus.GaugeValue, v, append(labels, aggregations[i])...)
+	}
+}
+
+func (a *Aggregate) send(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, v float64, labels ...string) {
+	metric, err := prometheus.NewConstMetric(desc, valueType, v, labels...)
+	if err != nil {
+		logrus.WithError(err).WithField("metric", desc.String()).Warnln("Skipping invalid metric")
+		return
+	}
+	ch <- metric
+}
+
+func groupByPipeline(metrics []*dto.Metric) map[string][]*dto.Metric {
+	grouped := make(map[string][]*dto.Metric)
+	for _, m := range metrics {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "pipeline" {
+				grouped[label.GetValue()] = append(grouped[label.GetValue()], m)
+				break
+			}
+		}
+	}
+	return grouped
+}
+
+func sortedKeys(m map[string][]*dto.Metric) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sum(metrics []*dto.Metric) float64 {
+	total := 0.0
+	for _, m := range metrics {
+		total += value(m)
+	}
+	return total
+}
+
+// value returns the value of a counter, gauge or untyped metric.
+func value(m *dto.Metric) float64 {
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	default:
+		return m.Untyped.GetValue()
+	}
+}
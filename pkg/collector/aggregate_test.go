@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"prom-logstash-exporter/pkg/discovery"
+	"prom-logstash-exporter/pkg/helpers"
+)
+
+// secondNodeStats returns the node_stats.json fixture of another node of the
+// fleet: only running the main pipeline, with different counters and usage.
+func secondNodeStats(t *testing.T) []byte {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal(readFixture(t, "node_stats.json"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	doc["jvm"].(map[string]interface{})["mem"].(map[string]interface{})["heap_used_percent"] = 57
+	pipelines := doc["pipelines"].(map[string]interface{})
+	delete(pipelines, ".monitoring-logstash")
+	main := pipelines["main"].(map[string]interface{})
+	main["events"].(map[string]interface{})["in"] = 457000
+	main["events"].(map[string]interface{})["out"] = 457020
+	main["flow"].(map[string]interface{})["worker_utilization"].(map[string]interface{})["current"] = 32.4
+	main["dead_letter_queue"].(map[string]interface{})["dropped_events"] = 5
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAggregate(t *testing.T) {
+	first := newFixtureServer(t, "node_stats.json")
+	second := newBodyServer(t, secondNodeStats(t))
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	targets, err := NewTargets(Options{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer targets.Close()
+	targets.Sync("file", []discovery.Target{
+		{Address: first.Listener.Addr().String()},
+		{Address: second.Listener.Addr().String()},
+		{Address: down.Listener.Addr().String()},
+	})
+
+	recorder := NewRecorder(targets)
+	aggregate, err := NewAggregate(recorder, helpers.Naming{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is aggregated before the targets are scraped.
+	before := gatherFamilies(t, aggregate)
+	if got := before["logstash_aggregate_targets"][""]; got != 0 {
+		t.Errorf("logstash_aggregate_targets before the first scrape = %v, want 0", got)
+	}
+	if _, ok := before["logstash_aggregate_pipeline_events_in"]; ok {
+		t.Error("pipeline events aggregated before the first scrape")
+	}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		recorder.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+	}
+
+	series := gatherFamilies(t, aggregate)
+	for _, test := range []struct {
+		family, labels string
+		want           float64
+	}{
+		{"logstash_aggregate_targets", "", 3},
+		{"logstash_aggregate_targets_up", "", 2},
+		{"logstash_aggregate_pipeline_events_in", "pipeline=main", 2000000},
+		{"logstash_aggregate_pipeline_events_in", "pipeline=.monitoring-logstash", 210},
+		{"logstash_aggregate_pipeline_events_out", "pipeline=main", 2000000},
+		{"logstash_aggregate_pipeline_dead_letter_queue_dropped_events", "pipeline=main", 5},
+		{"logstash_aggregate_pipeline_worker_utilization_ratio", "aggregation=min,pipeline=main", 0.124},
+		{"logstash_aggregate_pipeline_worker_utilization_ratio", "aggregation=max,pipeline=main", 0.324},
+		{"logstash_aggregate_pipeline_worker_utilization_ratio", "aggregation=avg,pipeline=main", 0.224},
+		{"logstash_aggregate_pipeline_worker_utilization_ratio", "aggregation=avg,pipeline=.monitoring-logstash", 0.001},
+		{"logstash_aggregate_jvm_heap_used_ratio", "aggregation=min", 0.37},
+		{"logstash_aggregate_jvm_heap_used_ratio", "aggregation=max", 0.57},
+		{"logstash_aggregate_jvm_heap_used_ratio", "aggregation=avg", 0.47},
+	} {
+		got, ok := series[test.family][test.labels]
+		if !ok {
+			t.Errorf("%s{%s} not aggregated", test.family, test.labels)
+			continue
+		}
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s{%s} = %v, want %v", test.family, test.labels, got, test.want)
+		}
+	}
+}
@@ -1,147 +1,488 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"net/http"
 	"prom-logstash-exporter/constants"
 	"prom-logstash-exporter/pkg/collector/node_stats"
 	"prom-logstash-exporter/pkg/helpers"
 	"prom-logstash-exporter/pkg/restclient"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Collector struct {
 	logstashClient   *LogstashClient
 	metricsCollector *MetricsCollector
+	collectors       Selection
 	mutex            sync.Mutex
 }
 
-func NewLogstashCollector(uri string) (*Collector, error) {
-	client, err := NewLogstashClient(uri)
-	if err != nil {
+// Options configures the metrics exposed by a Collector.
+type Options struct {
+	Client    ClientOptions
+	Pipelines node_stats.PipelinesCollectorOptions
+	// Collectors selects the enabled collectors, all of them when nil.
+	Collectors Selection
+	// StatusStateSet exposes logstash_status as a state set labeled by status
+	// instead of a single gauge holding the status code.
+	StatusStateSet bool
+	// ConstLabels are attached to every metric of the target, e.g. cluster or env.
+	ConstLabels prometheus.Labels
+	// LegacyMetricNames exposes the metrics renamed to follow the Prometheus
+	// naming conventions under their former names.
+	LegacyMetricNames bool
+}
+
+func (o Options) naming() helpers.Naming {
+	return helpers.Naming{Legacy: o.LegacyMetricNames}
+}
+
+// logstashStatuses lists the states of the logstash_status state set.
+var logstashStatuses = []string{"green", "yellow", "red", "unknown"}
+
+// reservedLabels are the label names the exposition format gives a meaning to.
+var reservedLabels = map[string]bool{"le": true, "quantile": true}
+
+// validateConstLabels rejects constant labels that are reserved or that a
+// metric of the collectors sets itself, so that they fail at startup rather
+// than on every scrape. Clashes are found from the descriptors of the metrics,
+// so labels added to a metric are covered without maintaining a list.
+func validateConstLabels(options Options) error {
+	names := make([]string, 0, len(options.ConstLabels))
+	for name := range options.ConstLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.HasPrefix(name, "__") || reservedLabels[name] {
+			return fmt.Errorf("constant label %q is reserved", name)
+		}
+
+		labelOptions := options
+		labelOptions.ConstLabels = prometheus.Labels{name: options.ConstLabels[name]}
+		if err := prometheus.NewRegistry().Register(NewMetricsCollector(labelOptions)); err != nil {
+			return fmt.Errorf("constant label %q conflicts with a metric label", name)
+		}
+	}
+	return nil
+}
+
+func NewLogstashCollector(uri string, options Options) (*Collector, error) {
+	if err := validateConstLabels(options); err != nil {
 		return nil, err
 	}
 
-	metricsCollector := NewMetricsCollector()
+	metricsCollector := NewMetricsCollector(options)
+
+	client, err := NewLogstashClient(uri, options.Client, metricsCollector)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Collector{
 		logstashClient:   client,
 		metricsCollector: metricsCollector,
+		collectors:       options.enabledCollectors(),
 	}, nil
 }
 
+// enabledCollectors returns the Collectors option, all collectors when unset.
+func (o Options) enabledCollectors() Selection {
+	if o.Collectors == nil {
+		return AllCollectors()
+	}
+	return o.Collectors
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.metricsCollector.Describe(ch)
 }
 
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(c.collectors, ch)
+}
+
+// Select returns a view of the collector running only the enabled collectors
+// whose name is in names, as requested with the collect[] query parameter.
+func (c *Collector) Select(names []string) (prometheus.Collector, error) {
+	collectors, err := c.collectors.Select(names)
+	if err != nil {
+		return nil, err
+	}
+	return &selectedCollector{collector: c, collectors: collectors}, nil
+}
+
+func (c *Collector) collect(collectors Selection, ch chan<- prometheus.Metric) {
 	c.mutex.Lock() // Protect metrics from concurrent collects
 	defer c.mutex.Unlock()
 
-	up := c.logstashClient.PerformScrape(c.metricsCollector, ch)
+	start := time.Now()
+	up := c.logstashClient.PerformScrape(c.metricsCollector, collectors, ch)
 	c.metricsCollector.UpdateUp(up)
+	c.metricsCollector.lastScrapeDuration.Set(time.Since(start).Seconds())
 	c.metricsCollector.Collect(ch)
 }
 
+type selectedCollector struct {
+	collector  *Collector
+	collectors Selection
+}
+
+func (s *selectedCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.collector.Describe(ch)
+}
+
+func (s *selectedCollector) Collect(ch chan<- prometheus.Metric) {
+	s.collector.collect(s.collectors, ch)
+}
+
+// Close releases the idle connections to Logstash once the collector is no longer used.
+func (c *Collector) Close() {
+	c.logstashClient.httpClient.CloseIdleConnections()
+}
+
+// ClientOptions configures how a LogstashClient queries Logstash.
+type ClientOptions struct {
+	// Timeout bounds a whole scrape, retries included.
+	Timeout time.Duration
+	// RetryAttempts is the number of retries of a failed request, 0 disables retries.
+	RetryAttempts int
+	// RetryBackoff is the base delay before the first retry.
+	RetryBackoff time.Duration
+	// CircuitBreakerThreshold is the number of consecutive failed scrapes opening
+	// the circuit breaker, 0 disables the circuit breaker.
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is how long scrapes are short-circuited once the circuit is open.
+	CircuitBreakerCooldown time.Duration
+}
+
 type LogstashClient struct {
-	handler restclient.HTTPHandlerInterface
+	target     string
+	handler    restclient.HTTPHandlerInterface
+	httpClient *http.Client
+	timeout    time.Duration
 }
 
-func NewLogstashClient(logstashURL string) (*LogstashClient, error) {
+func NewLogstashClient(logstashURL string, options ClientOptions, mc *MetricsCollector) (*LogstashClient, error) {
 	parsedURL, err := helpers.ParseURI(logstashURL)
 	if err != nil {
 		return nil, err
 	}
 
-	handler := &restclient.HTTPHandler{
-		Endpoint: fmt.Sprintf("%s%s", parsedURL, constants.StatsPath),
+	target := parsedURL.String()
+	httpClient := restclient.NewHTTPClient()
+	var handler restclient.HTTPHandlerInterface = &restclient.HTTPHandler{
+		Endpoint:     target,
+		Client:       httpClient,
+		OnConnection: mc.IncrementConnections,
+	}
+
+	if options.RetryAttempts > 0 {
+		handler = &restclient.RetryHandler{
+			Handler:  handler,
+			Attempts: options.RetryAttempts,
+			Backoff:  options.RetryBackoff,
+			OnRetry: func(err error) {
+				mc.IncrementRetries()
+				logrus.WithError(err).WithField("target", target).Warnln("Retrying Logstash request")
+			},
+		}
+	}
+
+	if options.CircuitBreakerThreshold > 0 {
+		handler = &restclient.CircuitBreaker{
+			Handler:       handler,
+			Threshold:     options.CircuitBreakerThreshold,
+			Cooldown:      options.CircuitBreakerCooldown,
+			OnStateChange: mc.UpdateCircuitBreakerOpen,
+		}
 	}
 
 	return &LogstashClient{
-		handler: handler,
+		target:     target,
+		handler:    handler,
+		httpClient: httpClient,
+		timeout:    options.Timeout,
 	}, nil
 }
 
-func (c *LogstashClient) PerformScrape(mc *MetricsCollector, ch chan<- prometheus.Metric) (up float64) {
+func (c *LogstashClient) PerformScrape(mc *MetricsCollector, collectors Selection, ch chan<- prometheus.Metric) (up float64) {
 	mc.IncrementTotalScrapes()
 
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	path := collectors.statsPath()
+
 	var stats node_stats.NodeStats
-	err := restclient.GetMetrics(c.handler, &stats)
+	var target interface{} = &stats
+	if mc.pluginMetrics && collectors[CollectorPipelinePlugins] {
+		target = (*node_stats.NodeStatsWithPluginFields)(&stats)
+	}
+	start := time.Now()
+	responseStats, err := restclient.GetMetricsWithStats(ctx, c.handler, path, target)
+	duration := time.Since(start)
+	mc.observeResponse(path, duration, responseStats)
+
+	log := logrus.WithFields(logrus.Fields{"target": c.target, "endpoint": path, "duration": duration})
 	if err != nil {
-		mc.logstashStatus.Set(2)
-		logrus.WithError(err).Errorln("Can't scrape Logstash", constants.StatsPath)
+		mc.RecordScrapeError(err)
+		log.WithError(err).Errorln("Can't scrape Logstash")
 		return 0
 	}
+	log.WithField("size", responseStats.Size).Debugln("Scraped Logstash")
+	mc.httpStatusCode.Set(http.StatusOK)
+	if len(responseStats.Skipped) > 0 {
+		mc.IncrementJsonParseFailures()
+		for _, err := range responseStats.Skipped {
+			log.WithError(err).Warnln("Skipping the Logstash stats holding values of unexpected types")
+		}
+	}
 
-	mc.UpdateLogstashStatus(stats)
-	mc.UpdateLogstashInfo(stats, ch)
+	if !stats.Skipped["status"] {
+		mc.UpdateLogstashStatus(stats, ch)
+	}
+	if !skippedAny(stats, "version", "http_address", "name", "id", "ephemeral_id") {
+		mc.UpdateLogstashInfo(stats, ch)
+	}
 
-	mc.jvm.Collect(stats.JVM, ch)
-	mc.event.Collect(stats.Event, ch)
-	mc.process.Collect(stats.Process, ch)
-	mc.pipelines.Collect(stats.Pipelines, ch)
-	mc.pipelineConfig.Collect(stats.Pipeline, ch)
-	mc.reloadsConfig.Collect(stats.Reloads, ch)
+	if collectors[CollectorJVM] && !stats.Skipped["jvm"] {
+		mc.countSeries(CollectorJVM, ch, func(ch chan<- prometheus.Metric) { mc.jvm.Collect(stats.JVM, ch) })
+	}
+	if collectors[CollectorEvents] && !stats.Skipped["events"] {
+		mc.countSeries(CollectorEvents, ch, func(ch chan<- prometheus.Metric) { mc.event.Collect(stats.Event, ch) })
+	}
+	if collectors[CollectorProcess] && !stats.Skipped["process"] {
+		mc.countSeries(CollectorProcess, ch, func(ch chan<- prometheus.Metric) { mc.process.Collect(stats.Process, ch) })
+	}
+	if (collectors[CollectorPipelines] || collectors[CollectorPipelinePlugins]) && !stats.Skipped["pipelines"] {
+		pipelines := mc.pipelines.Filter(stats.Pipelines)
+		if collectors[CollectorPipelines] {
+			mc.countSeries(CollectorPipelines, ch, func(ch chan<- prometheus.Metric) { mc.pipelines.Collect(pipelines, ch) })
+		}
+		if collectors[CollectorPipelinePlugins] {
+			mc.countSeries(CollectorPipelinePlugins, ch, func(ch chan<- prometheus.Metric) { mc.pipelines.CollectPlugins(pipelines, ch) })
+		}
+	}
+	if collectors[CollectorPipelineConfig] && !stats.Skipped["pipeline"] {
+		mc.countSeries(CollectorPipelineConfig, ch, func(ch chan<- prometheus.Metric) { mc.pipelineConfig.Collect(stats.Pipeline, ch) })
+	}
+	if collectors[CollectorReloads] && !stats.Skipped["reloads"] {
+		mc.countSeries(CollectorReloads, ch, func(ch chan<- prometheus.Metric) { mc.reloadsConfig.Collect(stats.Reloads, ch) })
+	}
 
 	return 1
 }
 
+// skippedAny reports whether any of the fields of stats was left out because of
+// a value of an unexpected type.
+func skippedAny(stats node_stats.NodeStats, fields ...string) bool {
+	for _, field := range fields {
+		if stats.Skipped[field] {
+			return true
+		}
+	}
+	return false
+}
+
 type MetricsCollector struct {
-	up                prometheus.Gauge
-	totalScrapes      prometheus.Counter
-	jsonParseFailures prometheus.Counter
-	logstashStatus    prometheus.Gauge
-	logstashInfo      *prometheus.Desc
-	jvm               *node_stats.JVMCollector
-	event             *node_stats.EventCollector
-	process           *node_stats.ProcessCollector
-	pipelines         *node_stats.PipelinesCollector
-	pipelineConfig    *node_stats.PipelineConfigCollector
-	reloadsConfig     *node_stats.ReloadsConfigCollector
-}
-
-func NewMetricsCollector() *MetricsCollector {
+	up                 prometheus.Gauge
+	lastScrapeDuration prometheus.Gauge
+	totalScrapes       prometheus.Counter
+	jsonParseFailures  prometheus.Counter
+	scrapeErrors       *prometheus.CounterVec
+	httpStatusCode     prometheus.Gauge
+	retries            prometheus.Counter
+	circuitOpen        prometheus.Gauge
+	connections        *prometheus.CounterVec
+	scrapeDuration     *prometheus.HistogramVec
+	responseSize       *prometheus.HistogramVec
+	decodeDuration     *prometheus.HistogramVec
+	series             *prometheus.GaugeVec
+	logstashStatus     *prometheus.Desc
+	statusStateSet     bool
+	logstashInfo       *prometheus.Desc
+	collectErrors      *prometheus.CounterVec
+	jvm                *node_stats.JVMCollector
+	event              *node_stats.EventCollector
+	process            *node_stats.ProcessCollector
+	pipelines          *node_stats.PipelinesCollector
+	pluginMetrics      bool
+	pipelineConfig     *node_stats.PipelineConfigCollector
+	reloadsConfig      *node_stats.ReloadsConfigCollector
+}
+
+func NewMetricsCollector(options Options) *MetricsCollector {
+	naming := options.naming()
+	collectErrors := node_stats.NewCollectErrors(options.ConstLabels)
+
+	scrapeErrors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   constants.Namespace,
+		Name:        "exporter_scrape_errors_total",
+		Help:        "Number of failed logstash scrapes by reason.",
+		ConstLabels: options.ConstLabels,
+	}, []string{"reason"})
+	for _, reason := range restclient.ErrorReasons {
+		scrapeErrors.WithLabelValues(reason)
+	}
+
+	connections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   constants.Namespace,
+		Name:        "exporter_connections_total",
+		Help:        "Number of connections used to query logstash, by whether they were reused from the pool.",
+		ConstLabels: options.ConstLabels,
+	}, []string{"reused"})
+	connections.WithLabelValues("true")
+	connections.WithLabelValues("false")
+
 	return &MetricsCollector{
 		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: constants.Namespace,
-			Name:      "up",
-			Help:      "Was the last scrape of logstash successful.",
+			Namespace:   constants.Namespace,
+			Name:        "up",
+			Help:        "Was the last scrape of logstash successful.",
+			ConstLabels: options.ConstLabels,
+		}),
+		lastScrapeDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_last_scrape_duration_seconds",
+			Help:        "Duration of the last scrape of logstash, collection of its metrics included.",
+			ConstLabels: options.ConstLabels,
 		}),
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: constants.Namespace,
-			Name:      "exporter_total_scrapes",
-			Help:      "Current total logstash scrapes.",
+			Name:        naming.BuildFQName(constants.Namespace, "", "exporter_scrapes_total"),
+			Help:        "Current total logstash scrapes.",
+			ConstLabels: options.ConstLabels,
 		}),
 		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: constants.Namespace,
-			Name:      "exporter_json_parse_failures",
-			Help:      "Number of errors while parsing JSON.",
+			Name:        naming.BuildFQName(constants.Namespace, "", "exporter_json_parse_failures_total"),
+			Help:        "Number of errors while parsing JSON.",
+			ConstLabels: options.ConstLabels,
+		}),
+		scrapeErrors: scrapeErrors,
+		httpStatusCode: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_http_status_code",
+			Help:        "HTTP status code returned by logstash on the last scrape, 0 if no response was received.",
+			ConstLabels: options.ConstLabels,
 		}),
-		logstashStatus: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: constants.Namespace,
-			Name:      "status",
-			Help:      "Logstash status: 0 for Green; 1 for Yellow; 2 for Red.",
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_retries_total",
+			Help:        "Number of retried logstash requests.",
+			ConstLabels: options.ConstLabels,
 		}),
-		logstashInfo:   prometheus.NewDesc(prometheus.BuildFQName(constants.Namespace, "", "info"), "A metric with a constant '1' value labeled by version, http_address, name, id and ephemeral_id from Logstash instance.", []string{"version", "http_address", "name", "id", "ephemeral_id"}, nil),
-		jvm:            node_stats.NewJVMCollector(),
-		event:          node_stats.NewEventCollector(),
-		process:        node_stats.NewProcessCollector(),
-		pipelines:      node_stats.NewPipelinesCollector(),
-		pipelineConfig: node_stats.NewPipelineConfigCollector(),
-		reloadsConfig:  node_stats.NewReloadsConfigCollector(),
+		circuitOpen: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_circuit_breaker_open",
+			Help:        "Whether scrapes of logstash are short-circuited because it is known to be down.",
+			ConstLabels: options.ConstLabels,
+		}),
+		connections: connections,
+		scrapeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_scrape_duration_seconds",
+			Help:        "Duration of the requests to logstash, retries and decoding included, by endpoint.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: options.ConstLabels,
+		}, []string{"endpoint"}),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_response_size_bytes",
+			Help:        "Size of the decompressed logstash responses, by endpoint.",
+			Buckets:     prometheus.ExponentialBuckets(1024, 4, 8),
+			ConstLabels: options.ConstLabels,
+		}, []string{"endpoint"}),
+		decodeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_decode_duration_seconds",
+			Help:        "Duration of the reading and decoding of the logstash responses, by endpoint.",
+			Buckets:     prometheus.ExponentialBuckets(0.0005, 4, 8),
+			ConstLabels: options.ConstLabels,
+		}, []string{"endpoint"}),
+		series: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_series",
+			Help:        "Number of series sent by each collector on the last successful scrape.",
+			ConstLabels: options.ConstLabels,
+		}, []string{"collector"}),
+		logstashStatus: newLogstashStatusDesc(naming, options.StatusStateSet, options.ConstLabels),
+		statusStateSet: options.StatusStateSet,
+		logstashInfo:   prometheus.NewDesc(naming.BuildFQName(constants.Namespace, "", "info"), "A metric with a constant '1' value labeled by version, http_address, name, id and ephemeral_id from Logstash instance.", []string{"version", "http_address", "name", "id", "ephemeral_id"}, options.ConstLabels),
+		collectErrors:  collectErrors,
+		jvm:            node_stats.NewJVMCollector(collectErrors, naming, options.ConstLabels),
+		event:          node_stats.NewEventCollector(collectErrors, naming, options.ConstLabels),
+		process:        node_stats.NewProcessCollector(collectErrors, naming, options.ConstLabels),
+		pipelines:      node_stats.NewPipelinesCollector(options.Pipelines, collectErrors, naming, options.ConstLabels),
+		pluginMetrics:  options.Pipelines.PluginMetrics,
+		pipelineConfig: node_stats.NewPipelineConfigCollector(collectErrors, naming, options.ConstLabels),
+		reloadsConfig:  node_stats.NewReloadsConfigCollector(collectErrors, naming, options.ConstLabels),
+	}
+}
+
+func newLogstashStatusDesc(naming helpers.Naming, stateSet bool, constLabels prometheus.Labels) *prometheus.Desc {
+	name := naming.BuildFQName(constants.Namespace, "", "status")
+	if stateSet {
+		return prometheus.NewDesc(name, "Logstash status reported by the node: 1 for the current status, 0 otherwise.", []string{"status"}, constLabels)
 	}
+	return prometheus.NewDesc(name, "Logstash status: 0 for Green; 1 for Yellow; 2 for Red; 3 for Unknown.", nil, constLabels)
 }
 
 func (mc *MetricsCollector) Describe(ch chan<- *prometheus.Desc) {
-	prometheus.DescribeByCollect(mc, ch)
+	ch <- mc.up.Desc()
+	ch <- mc.lastScrapeDuration.Desc()
+	ch <- mc.totalScrapes.Desc()
+	ch <- mc.jsonParseFailures.Desc()
+	mc.scrapeErrors.Describe(ch)
+	ch <- mc.httpStatusCode.Desc()
+	ch <- mc.retries.Desc()
+	ch <- mc.circuitOpen.Desc()
+	mc.connections.Describe(ch)
+	mc.scrapeDuration.Describe(ch)
+	mc.responseSize.Describe(ch)
+	mc.decodeDuration.Describe(ch)
+	mc.series.Describe(ch)
+	ch <- mc.logstashStatus
+	ch <- mc.logstashInfo
+	mc.collectErrors.Describe(ch)
+	mc.jvm.Describe(ch)
+	mc.event.Describe(ch)
+	mc.process.Describe(ch)
+	mc.pipelines.Describe(ch)
+	mc.pipelineConfig.Describe(ch)
+	mc.reloadsConfig.Describe(ch)
 }
 
 func (mc *MetricsCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- mc.up
+	ch <- mc.lastScrapeDuration
 	ch <- mc.totalScrapes
 	ch <- mc.jsonParseFailures
-	ch <- mc.logstashStatus
+	mc.scrapeErrors.Collect(ch)
+	ch <- mc.httpStatusCode
+	ch <- mc.retries
+	ch <- mc.circuitOpen
+	mc.connections.Collect(ch)
+	mc.scrapeDuration.Collect(ch)
+	mc.responseSize.Collect(ch)
+	mc.decodeDuration.Collect(ch)
+	mc.series.Collect(ch)
+	mc.collectErrors.Collect(ch)
+	mc.pipelines.DuplicatePlugins.Collect(ch)
+	mc.pipelines.FilteredObjects.Collect(ch)
+	ch <- mc.pipelines.SeriesDropped
 }
 
 func (mc *MetricsCollector) UpdateUp(up float64) {
@@ -156,17 +497,115 @@ func (mc *MetricsCollector) IncrementJsonParseFailures() {
 	mc.jsonParseFailures.Inc()
 }
 
-func (mc *MetricsCollector) UpdateLogstashStatus(stats node_stats.NodeStats) {
-	switch stats.Status {
+func (mc *MetricsCollector) IncrementRetries() {
+	mc.retries.Inc()
+}
+
+func (mc *MetricsCollector) IncrementConnections(reused bool) {
+	mc.connections.WithLabelValues(strconv.FormatBool(reused)).Inc()
+}
+
+func (mc *MetricsCollector) UpdateCircuitBreakerOpen(open bool) {
+	if open {
+		mc.circuitOpen.Set(1)
+		return
+	}
+	mc.circuitOpen.Set(0)
+}
+
+// observeResponse records the duration of a request to Logstash and, when a
+// response body was read, its size and decode duration.
+func (mc *MetricsCollector) observeResponse(endpoint string, duration time.Duration, stats restclient.ResponseStats) {
+	mc.scrapeDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	if stats.Size > 0 {
+		mc.responseSize.WithLabelValues(endpoint).Observe(float64(stats.Size))
+		mc.decodeDuration.WithLabelValues(endpoint).Observe(stats.DecodeDuration.Seconds())
+	}
+}
+
+// countSeries runs collect, forwarding the metrics it sends to ch and recording
+// their number as the series of the named collector.
+func (mc *MetricsCollector) countSeries(name string, ch chan<- prometheus.Metric, collect func(ch chan<- prometheus.Metric)) {
+	forward := make(chan prometheus.Metric, 64)
+	count := make(chan int)
+	go func() {
+		n := 0
+		for metric := range forward {
+			ch <- metric
+			n++
+		}
+		count <- n
+	}()
+
+	collect(forward)
+	close(forward)
+	mc.series.WithLabelValues(name).Set(float64(<-count))
+}
+
+// RecordScrapeError counts a failed scrape by the reason reported by the restclient
+// and records the HTTP status code Logstash answered with.
+func (mc *MetricsCollector) RecordScrapeError(err error) {
+	var restErr *restclient.Error
+	if !errors.As(err, &restErr) {
+		mc.scrapeErrors.WithLabelValues(restclient.ReasonConnect).Inc()
+		mc.httpStatusCode.Set(0)
+		return
+	}
+
+	mc.scrapeErrors.WithLabelValues(restErr.Reason).Inc()
+	mc.httpStatusCode.Set(float64(restErr.StatusCode))
+	if restErr.Reason == restclient.ReasonDecode {
+		mc.IncrementJsonParseFailures()
+	}
+}
+
+// UpdateLogstashStatus sends the health status reported by Logstash. It is only
+// called after a successful scrape, so unreachable targets expose no status at all.
+func (mc *MetricsCollector) UpdateLogstashStatus(stats node_stats.NodeStats, ch chan<- prometheus.Metric) {
+	status := stats.Status
+	if status != "green" && status != "yellow" && status != "red" {
+		status = "unknown"
+	}
+
+	if mc.statusStateSet {
+		for _, s := range logstashStatuses {
+			value := 0.0
+			if s == status {
+				value = 1.0
+			}
+			mc.sendStatus(ch, value, s)
+		}
+		return
+	}
+
+	switch status {
 	case "green":
-		mc.logstashStatus.Set(0)
+		mc.sendStatus(ch, 0)
 	case "yellow":
-		mc.logstashStatus.Set(1)
+		mc.sendStatus(ch, 1)
+	case "red":
+		mc.sendStatus(ch, 2)
 	default:
-		mc.logstashStatus.Set(2)
+		mc.sendStatus(ch, 3)
 	}
 }
 
+func (mc *MetricsCollector) sendStatus(ch chan<- prometheus.Metric, value float64, labels ...string) {
+	metric, err := prometheus.NewConstMetric(mc.logstashStatus, prometheus.GaugeValue, value, labels...)
+	if err != nil {
+		mc.collectErrors.WithLabelValues("status").Inc()
+		logrus.WithError(err).WithField("metric", mc.logstashStatus.String()).Warnln("Skipping invalid metric")
+		return
+	}
+	ch <- metric
+}
+
 func (mc *MetricsCollector) UpdateLogstashInfo(stats node_stats.NodeStats, ch chan<- prometheus.Metric) {
-	ch <- prometheus.MustNewConstMetric(mc.logstashInfo, prometheus.GaugeValue, 1.0, stats.Version, stats.HttpAddress, stats.Name, stats.ID, stats.EphemeralID)
+	metric, err := prometheus.NewConstMetric(mc.logstashInfo, prometheus.GaugeValue, 1.0, stats.Version, stats.HttpAddress, stats.Name, stats.ID, stats.EphemeralID)
+	if err != nil {
+		mc.collectErrors.WithLabelValues("info").Inc()
+		logrus.WithError(err).WithField("metric", mc.logstashInfo.String()).Warnln("Skipping invalid metric")
+		return
+	}
+	ch <- metric
 }
@@ -0,0 +1,296 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"prom-logstash-exporter/pkg/collector/node_stats"
+)
+
+// newFixtureServer returns a fake Logstash serving the node_stats testdata
+// fixture file on every path.
+func newFixtureServer(tb testing.TB, file string) *httptest.Server {
+	tb.Helper()
+	return newBodyServer(tb, readFixture(tb, file))
+}
+
+func readFixture(tb testing.TB, file string) []byte {
+	tb.Helper()
+	data, err := os.ReadFile("node_stats/testdata/" + file)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// newBodyServer returns a fake Logstash serving data on every path.
+func newBodyServer(tb testing.TB, data []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}))
+	tb.Cleanup(server.Close)
+	return server
+}
+
+func TestCollectorLint(t *testing.T) {
+	server := newFixtureServer(t, "node_stats.json")
+
+	for name, options := range map[string]Options{
+		"default": {},
+		"all": {
+			Pipelines:      node_stats.PipelinesCollectorOptions{PluginMetrics: true},
+			StatusStateSet: true,
+		},
+	} {
+		options := options
+		t.Run(name, func(t *testing.T) {
+			c, err := NewLogstashCollector(server.URL, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			problems, err := testutil.CollectAndLint(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range problems {
+				t.Errorf("%s: %s", problem.Metric, problem.Text)
+			}
+
+			// Make sure the fixture was scraped rather than linting the exporter metrics only.
+			if n := testutil.CollectAndCount(c, "logstash_pipeline_event_in_total"); n != 2 {
+				t.Errorf("collected %d logstash_pipeline_event_in_total series, want 2", n)
+			}
+		})
+	}
+}
+
+func TestLegacyMetricNames(t *testing.T) {
+	server := newFixtureServer(t, "node_stats.json")
+
+	for _, test := range []struct {
+		legacy bool
+		name   string
+	}{
+		{false, "logstash_jvm_threads"},
+		{true, "logstash_jvm_threads_count"},
+	} {
+		c, err := NewLogstashCollector(server.URL, Options{LegacyMetricNames: test.legacy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := testutil.CollectAndCount(c, test.name); n != 1 {
+			t.Errorf("LegacyMetricNames %v: collected %d %s series, want 1", test.legacy, n, test.name)
+		}
+		c.Close()
+	}
+}
+
+// gatherFamilies scrapes c once with a pedantic registry, which fails on
+// inconsistent or duplicate series, and returns the value of every series
+// keyed by family name and labels.
+func gatherFamilies(t *testing.T, c prometheus.Collector) map[string]map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := make(map[string]map[string]float64)
+	for _, family := range families {
+		series[family.GetName()] = make(map[string]float64)
+		for _, metric := range family.GetMetric() {
+			var labels []string
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			var value float64
+			switch {
+			case metric.GetCounter() != nil:
+				value = metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				value = metric.GetGauge().GetValue()
+			case metric.GetSummary() != nil:
+				value = float64(metric.GetSummary().GetSampleCount())
+			}
+			series[family.GetName()][strings.Join(labels, ",")] = value
+		}
+	}
+	return series
+}
+
+// TestMalformedResponses scrapes fixtures with missing sections, nulls, values
+// of the wrong type, duplicate plugins and truncated documents: the scrape must
+// not panic and only leave out the series of the invalid parts.
+func TestMalformedResponses(t *testing.T) {
+	for _, test := range []struct {
+		file string
+		up   float64
+		// series are the expected number of series of families, 0 for none.
+		series            map[string]int
+		jsonParseFailures float64
+	}{
+		{
+			file: "missing_sections.json",
+			up:   1,
+			series: map[string]int{
+				"logstash_status":                  1,
+				"logstash_info":                    1,
+				"logstash_pipeline_event_in_total": 1,
+			},
+		},
+		{
+			file: "nulls.json",
+			up:   1,
+			series: map[string]int{
+				"logstash_status": 1,
+				"logstash_info":   1,
+				"logstash_jvm_gc_collection_duration_seconds": 2,
+				"logstash_pipeline_event_in_total":            2,
+				"logstash_pipeline_filter_failures_total":     1,
+				"logstash_pipeline_filter_matches_total":      0,
+			},
+		},
+		{
+			file: "wrong_types.json",
+			up:   1,
+			series: map[string]int{
+				"logstash_status":                         0,
+				"logstash_info":                           1,
+				"logstash_jvm_threads":                    0,
+				"logstash_jvm_heap_used_bytes":            0,
+				"logstash_process_open_file_descriptors":  1,
+				"logstash_event_in_total":                 1,
+				"logstash_pipeline_config_workers":        1,
+				"logstash_reloads_config_successes_total": 1,
+				"logstash_pipeline_event_in_total":        1,
+				"logstash_pipeline_output_in_total":       1,
+			},
+			jsonParseFailures: 1,
+		},
+		{
+			file: "duplicate_plugins.json",
+			up:   1,
+			series: map[string]int{
+				"logstash_pipeline_filter_in_total":         1,
+				"logstash_exporter_duplicate_plugins_total": 1,
+			},
+		},
+		{
+			file: "truncated.json",
+			up:   0,
+			series: map[string]int{
+				"logstash_status":                  0,
+				"logstash_pipeline_event_in_total": 0,
+			},
+			jsonParseFailures: 1,
+		},
+	} {
+		test := test
+		server := newFixtureServer(t, test.file)
+		for _, pluginMetrics := range []bool{false, true} {
+			options := Options{Pipelines: node_stats.PipelinesCollectorOptions{PluginMetrics: pluginMetrics}}
+			t.Run(fmt.Sprintf("%s/plugin_metrics=%v", test.file, pluginMetrics), func(t *testing.T) {
+				c, err := NewLogstashCollector(server.URL, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer c.Close()
+
+				series := gatherFamilies(t, c)
+				if up := series["logstash_up"][""]; up != test.up {
+					t.Errorf("logstash_up = %v, want %v", up, test.up)
+				}
+				for name, want := range test.series {
+					if got := len(series[name]); got != want {
+						t.Errorf("%s has %d series, want %d: %v", name, got, want, series[name])
+					}
+				}
+				if got := series["logstash_exporter_json_parse_failures_total"][""]; got != test.jsonParseFailures {
+					t.Errorf("logstash_exporter_json_parse_failures_total = %v, want %v", got, test.jsonParseFailures)
+				}
+				for collector, errors := range series["logstash_exporter_collect_errors_total"] {
+					if errors != 0 {
+						t.Errorf("logstash_exporter_collect_errors_total{%s} = %v, want 0", collector, errors)
+					}
+				}
+			})
+		}
+	}
+}
+
+// largeNodeStats returns the node_stats.json fixture with its main pipeline
+// repeated n times, the size of the documents of nodes running many pipelines.
+func largeNodeStats(tb testing.TB, n int) []byte {
+	tb.Helper()
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(readFixture(tb, "node_stats.json"), &doc); err != nil {
+		tb.Fatal(err)
+	}
+	var pipelines map[string]json.RawMessage
+	if err := json.Unmarshal(doc["pipelines"], &pipelines); err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		pipelines["main_"+strconv.Itoa(i)] = pipelines["main"]
+	}
+
+	var err error
+	if doc["pipelines"], err = json.Marshal(pipelines); err != nil {
+		tb.Fatal(err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// BenchmarkPerformScrape measures whole scrapes of a node running many
+// pipelines, from the request to Logstash to the collected series, with and
+// without the plugin_metric series.
+func BenchmarkPerformScrape(b *testing.B) {
+	data := largeNodeStats(b, 50)
+	server := newBodyServer(b, data)
+
+	for _, pluginMetrics := range []bool{false, true} {
+		options := Options{Pipelines: node_stats.PipelinesCollectorOptions{PluginMetrics: pluginMetrics}}
+		b.Run(fmt.Sprintf("plugin_metrics=%v", pluginMetrics), func(b *testing.B) {
+			c, err := NewLogstashCollector(server.URL, options)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+
+			ch := make(chan prometheus.Metric, 1024)
+			drained := make(chan struct{})
+			go func() {
+				for range ch {
+				}
+				close(drained)
+			}()
+
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Collect(ch)
+			}
+			b.StopTimer()
+			close(ch)
+			<-drained
+		})
+	}
+}
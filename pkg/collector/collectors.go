@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"fmt"
+	"prom-logstash-exporter/constants"
+	"sort"
+	"strings"
+)
+
+// Names of the collectors that can be toggled with the --collector.<name> flags
+// and selected with the collect[] query parameter of /metrics.
+const (
+	CollectorJVM             = "jvm"
+	CollectorEvents          = "events"
+	CollectorProcess         = "process"
+	CollectorPipelines       = "pipelines"
+	CollectorPipelinePlugins = "pipelines.plugins"
+	CollectorPipelineConfig  = "pipeline_config"
+	CollectorReloads         = "reloads"
+)
+
+// CollectorNames lists every collector that can be toggled.
+var CollectorNames = []string{
+	CollectorJVM,
+	CollectorEvents,
+	CollectorProcess,
+	CollectorPipelines,
+	CollectorPipelinePlugins,
+	CollectorPipelineConfig,
+	CollectorReloads,
+}
+
+// collectorSections maps the collectors to the node stats section they read.
+// The pipeline config is part of the node metadata returned with every section.
+var collectorSections = map[string]string{
+	CollectorJVM:             "jvm",
+	CollectorEvents:          "events",
+	CollectorProcess:         "process",
+	CollectorPipelines:       "pipelines",
+	CollectorPipelinePlugins: "pipelines",
+	CollectorReloads:         "reloads",
+}
+
+// Selection is the set of enabled collectors.
+type Selection map[string]bool
+
+// AllCollectors returns a Selection enabling every collector.
+func AllCollectors() Selection {
+	s := Selection{}
+	for _, name := range CollectorNames {
+		s[name] = true
+	}
+	return s
+}
+
+// Select returns the collectors of s whose name is in names, failing when a
+// name is unknown or its collector is disabled in s.
+func (s Selection) Select(names []string) (Selection, error) {
+	selected := Selection{}
+	for _, name := range names {
+		enabled, ok := s[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector %q, must be one of %s", name, strings.Join(CollectorNames, ", "))
+		}
+		if !enabled {
+			return nil, fmt.Errorf("collector %q is disabled on the command line", name)
+		}
+		selected[name] = true
+	}
+	return selected, nil
+}
+
+// statsPath returns the path of the node stats API returning only the sections
+// read by the enabled collectors.
+func (s Selection) statsPath() string {
+	seen := map[string]bool{}
+	var sections []string
+	for name, enabled := range s {
+		section, ok := collectorSections[name]
+		if !enabled || !ok || seen[section] {
+			continue
+		}
+		seen[section] = true
+		sections = append(sections, section)
+	}
+
+	if len(sections) == 0 {
+		return constants.StatsPath
+	}
+
+	sort.Strings(sections)
+	return constants.StatsPath + "/" + strings.Join(sections, ",")
+}
@@ -0,0 +1,28 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectionSelect(t *testing.T) {
+	enabled := AllCollectors()
+	enabled[CollectorPipelinePlugins] = false
+
+	selected, err := enabled.Select([]string{CollectorJVM, CollectorProcess})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Selection{CollectorJVM: true, CollectorProcess: true}); !reflect.DeepEqual(selected, want) {
+		t.Errorf("selected %v, want %v", selected, want)
+	}
+
+	for _, names := range [][]string{
+		{"bogus"},
+		{CollectorJVM, CollectorPipelinePlugins},
+	} {
+		if _, err := enabled.Select(names); err == nil {
+			t.Errorf("selecting %v succeeded, want an error", names)
+		}
+	}
+}
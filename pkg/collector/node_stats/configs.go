@@ -7,62 +7,76 @@ import (
 )
 
 type PipelineConfigCollector struct {
-	Workers    *prometheus.Desc
-	BatchSize  *prometheus.Desc
-	BatchDelay *prometheus.Desc
+	Workers    helpers.MetricDef
+	BatchSize  helpers.MetricDef
+	BatchDelay helpers.MetricDef
+
+	errors prometheus.Counter
 }
 
-func NewPipelineConfigCollector() *PipelineConfigCollector {
-	desc := helpers.NewDescFQ(constants.Namespace, "pipeline_config")
+func NewPipelineConfigCollector(errors *prometheus.CounterVec, naming helpers.Naming, constLabels prometheus.Labels) *PipelineConfigCollector {
+	metric := naming.NewMetricDefFQ(constants.Namespace, "pipeline_config", constLabels)
 	return &PipelineConfigCollector{
-		Workers:    desc("workers", "The number of workers that will, in parallel, execute the filter and output stages of the pipeline."),
-		BatchSize:  desc("batch_size", "The maximum number of events an individual worker thread will collect from inputs before attempting to execute its filters and outputs."),
-		BatchDelay: desc("batch_delay_seconds", "How long to wait before dispatching an undersized batch to workers."),
+		Workers:    metric("workers", prometheus.GaugeValue, "The number of workers that will, in parallel, execute the filter and output stages of the pipeline."),
+		BatchSize:  metric("batch_size", prometheus.GaugeValue, "The maximum number of events an individual worker thread will collect from inputs before attempting to execute its filters and outputs."),
+		BatchDelay: metric("batch_delay_seconds", prometheus.GaugeValue, "How long to wait before dispatching an undersized batch to workers."),
+
+		errors: errors.WithLabelValues("pipeline_config"),
 	}
 }
 
+func (c *PipelineConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	helpers.DescribeMetricDefs(ch, c.Workers, c.BatchSize, c.BatchDelay)
+}
+
 func (c *PipelineConfigCollector) Collect(p PipelineConfig, ch chan<- prometheus.Metric) {
 	metrics := []struct {
-		desc      *prometheus.Desc
-		valueType prometheus.ValueType
-		value     float64
-		labels    []string
+		def    helpers.MetricDef
+		value  float64
+		labels []string
 	}{
-		{c.Workers, prometheus.GaugeValue, float64(p.Workers), nil},
-		{c.BatchSize, prometheus.GaugeValue, float64(p.BatchSize), nil},
-		{c.BatchDelay, prometheus.GaugeValue, float64(p.BatchDelay) / 1000.0, nil},
+		{c.Workers, float64(p.Workers), nil},
+		{c.BatchSize, float64(p.BatchSize), nil},
+		{c.BatchDelay, float64(p.BatchDelay) / 1000.0, nil},
 	}
 
 	for _, m := range metrics {
-		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value, m.labels...)
+		sendConstMetric(ch, c.errors, m.def, m.value, m.labels...)
 	}
 }
 
 type ReloadsConfigCollector struct {
-	Failures  *prometheus.Desc
-	Successes *prometheus.Desc
+	Failures  helpers.MetricDef
+	Successes helpers.MetricDef
+
+	errors prometheus.Counter
 }
 
-func NewReloadsConfigCollector() *ReloadsConfigCollector {
-	desc := helpers.NewDescFQ(constants.Namespace, "reloads_config")
+func NewReloadsConfigCollector(errors *prometheus.CounterVec, naming helpers.Naming, constLabels prometheus.Labels) *ReloadsConfigCollector {
+	metric := naming.NewMetricDefFQ(constants.Namespace, "reloads_config", constLabels)
 	return &ReloadsConfigCollector{
-		Failures:  desc("failures_total", "Number of failures during config reload."),
-		Successes: desc("successes_total", "Number of successful config reloads."),
+		Failures:  metric("failures_total", prometheus.CounterValue, "Number of failures during config reload."),
+		Successes: metric("successes_total", prometheus.CounterValue, "Number of successful config reloads."),
+
+		errors: errors.WithLabelValues("reloads_config"),
 	}
 }
 
+func (c *ReloadsConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	helpers.DescribeMetricDefs(ch, c.Failures, c.Successes)
+}
+
 func (c *ReloadsConfigCollector) Collect(p ReloadsConfig, ch chan<- prometheus.Metric) {
 	metrics := []struct {
-		desc      *prometheus.Desc
-		valueType prometheus.ValueType
-		value     float64
-		labels    []string
+		def    helpers.MetricDef
+		value  float64
+		labels []string
 	}{
-		{c.Failures, prometheus.CounterValue, float64(p.Failures), nil},
-		{c.Successes, prometheus.CounterValue, float64(p.Successes), nil},
+		{c.Failures, float64(p.Failures), nil},
+		{c.Successes, float64(p.Successes), nil},
 	}
 
 	for _, m := range metrics {
-		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value, m.labels...)
+		sendConstMetric(ch, c.errors, m.def, m.value, m.labels...)
 	}
 }
@@ -0,0 +1,45 @@
+package node_stats
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"prom-logstash-exporter/constants"
+	"prom-logstash-exporter/pkg/helpers"
+)
+
+// NewCollectErrors returns the counter of metrics the collectors failed to build,
+// labeled by collector name.
+func NewCollectErrors(constLabels prometheus.Labels) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   constants.Namespace,
+		Name:        "exporter_collect_errors_total",
+		Help:        "Number of metrics skipped because they could not be built during collect.",
+		ConstLabels: constLabels,
+	}, []string{"collector"})
+}
+
+// sendConstMetric builds a constant metric and sends it to ch. Metrics that cannot
+// be built (label count mismatch, invalid UTF-8 label values, ...) are skipped and
+// counted in errors instead of panicking inside the registry.
+func sendConstMetric(ch chan<- prometheus.Metric, errors prometheus.Counter, def helpers.MetricDef, value float64, labels ...string) {
+	metric, err := def.NewMetric(value, labels...)
+	if err != nil {
+		skipInvalidMetric(errors, def.Desc, err)
+		return
+	}
+	ch <- metric
+}
+
+func sendConstSummary(ch chan<- prometheus.Metric, errors prometheus.Counter, desc *prometheus.Desc, count uint64, sum float64, labels ...string) {
+	metric, err := prometheus.NewConstSummary(desc, count, sum, nil, labels...)
+	if err != nil {
+		skipInvalidMetric(errors, desc, err)
+		return
+	}
+	ch <- metric
+}
+
+func skipInvalidMetric(errors prometheus.Counter, desc *prometheus.Desc, err error) {
+	errors.Inc()
+	logrus.WithError(err).WithField("metric", desc.String()).Warnln("Skipping invalid metric")
+}
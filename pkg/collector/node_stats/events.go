@@ -7,41 +7,48 @@ import (
 )
 
 type EventCollector struct {
-	In                *prometheus.Desc
-	Filtered          *prometheus.Desc
-	Out               *prometheus.Desc
-	Duration          *prometheus.Desc
-	QueuePushDuration *prometheus.Desc
+	In                helpers.MetricDef
+	Filtered          helpers.MetricDef
+	Out               helpers.MetricDef
+	Duration          helpers.MetricDef
+	QueuePushDuration helpers.MetricDef
+
+	errors prometheus.Counter
 }
 
-func NewEventCollector() *EventCollector {
-	desc := helpers.NewDescFQ(constants.Namespace, "event")
+func NewEventCollector(errors *prometheus.CounterVec, naming helpers.Naming, constLabels prometheus.Labels) *EventCollector {
+	metric := naming.NewMetricDefFQ(constants.Namespace, "event", constLabels)
 	return &EventCollector{
-		In:                desc("in_total", "The total number of events in."),
-		Filtered:          desc("filtered_total", "The total numbers of filtered."),
-		Out:               desc("out_total", "The total number of events out."),
-		Duration:          desc("duration_seconds_total", "The total process duration time in seconds."),
-		QueuePushDuration: desc("queue_push_duration_seconds_total", "The total in queue duration time in seconds."),
+		In:                metric("in_total", prometheus.CounterValue, "The total number of events in."),
+		Filtered:          metric("filtered_total", prometheus.CounterValue, "The total numbers of filtered."),
+		Out:               metric("out_total", prometheus.CounterValue, "The total number of events out."),
+		Duration:          metric("duration_seconds_total", prometheus.CounterValue, "The total process duration time in seconds."),
+		QueuePushDuration: metric("queue_push_duration_seconds_total", prometheus.CounterValue, "The total in queue duration time in seconds."),
+
+		errors: errors.WithLabelValues("event"),
 	}
 }
 
+func (c *EventCollector) Describe(ch chan<- *prometheus.Desc) {
+	helpers.DescribeMetricDefs(ch, c.In, c.Filtered, c.Out, c.Duration, c.QueuePushDuration)
+}
+
 type eventMetricData struct {
-	desc      *prometheus.Desc
-	valueType prometheus.ValueType
-	value     float64
-	labels    []string
+	def    helpers.MetricDef
+	value  float64
+	labels []string
 }
 
 func (c *EventCollector) Collect(e Event, ch chan<- prometheus.Metric) {
 	metrics := []eventMetricData{
-		{c.In, prometheus.CounterValue, float64(e.In), nil},
-		{c.Filtered, prometheus.CounterValue, float64(e.Filtered), nil},
-		{c.Out, prometheus.CounterValue, float64(e.Out), nil},
-		{c.Duration, prometheus.CounterValue, float64(e.DurationInMillis) / 1000.0, nil},
-		{c.QueuePushDuration, prometheus.CounterValue, float64(e.QueuePushDurationInMillis) / 1000.0, nil},
+		{c.In, float64(e.In), nil},
+		{c.Filtered, float64(e.Filtered), nil},
+		{c.Out, float64(e.Out), nil},
+		{c.Duration, float64(e.DurationInMillis) / 1000.0, nil},
+		{c.QueuePushDuration, float64(e.QueuePushDurationInMillis) / 1000.0, nil},
 	}
 
 	for _, m := range metrics {
-		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value, m.labels...)
+		sendConstMetric(ch, c.errors, m.def, m.value, m.labels...)
 	}
 }
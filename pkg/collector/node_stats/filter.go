@@ -0,0 +1,45 @@
+package node_stats
+
+import (
+	"regexp"
+)
+
+// PipelinesFilter selects the pipelines and plugins series are built for. A nil
+// include regexp matches everything, a nil exclude regexp matches nothing.
+type PipelinesFilter struct {
+	// PipelineInclude and PipelineExclude match pipeline names.
+	PipelineInclude *regexp.Regexp
+	PipelineExclude *regexp.Regexp
+	// PluginInclude and PluginExclude match plugin IDs and names: a plugin is
+	// included when its ID or name matches, excluded when its ID or name matches.
+	PluginInclude *regexp.Regexp
+	PluginExclude *regexp.Regexp
+}
+
+func (f PipelinesFilter) pipelineAllowed(name string) bool {
+	return allowed(f.PipelineInclude, f.PipelineExclude, name)
+}
+
+func (f PipelinesFilter) pluginAllowed(id, name string) bool {
+	return allowed(f.PluginInclude, f.PluginExclude, id, name)
+}
+
+func (f PipelinesFilter) filtersPlugins() bool {
+	return f.PluginInclude != nil || f.PluginExclude != nil
+}
+
+func allowed(include, exclude *regexp.Regexp, values ...string) bool {
+	if include != nil && !matchAny(include, values) {
+		return false
+	}
+	return exclude == nil || !matchAny(exclude, values)
+}
+
+func matchAny(re *regexp.Regexp, values []string) bool {
+	for _, value := range values {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,63 +7,75 @@ import (
 )
 
 type JVMCollector struct {
-	ThreadsCount         *prometheus.Desc
-	HeapUsedRatio        *prometheus.Desc
-	HeapCommittedInBytes *prometheus.Desc
-	HeapUsedInBytes      *prometheus.Desc
-	PoolUsedBytes        *prometheus.Desc
-	PoolCommittedBytes   *prometheus.Desc
-	PoolMaxBytes         *prometheus.Desc
+	ThreadsCount         helpers.MetricDef
+	HeapUsedRatio        helpers.MetricDef
+	HeapCommittedInBytes helpers.MetricDef
+	HeapUsedInBytes      helpers.MetricDef
+	PoolUsedBytes        helpers.MetricDef
+	PoolCommittedBytes   helpers.MetricDef
+	PoolMaxBytes         helpers.MetricDef
 	GC                   *prometheus.Desc
+
+	errors prometheus.Counter
 }
 
-func NewJVMCollector() *JVMCollector {
-	desc := helpers.NewDescFQ(constants.Namespace, "jvm")
+func NewJVMCollector(errors *prometheus.CounterVec, naming helpers.Naming, constLabels prometheus.Labels) *JVMCollector {
+	metric := naming.NewMetricDefFQ(constants.Namespace, "jvm", constLabels)
+	desc := naming.NewDescFQ(constants.Namespace, "jvm", constLabels)
 	return &JVMCollector{
-		ThreadsCount:         desc("threads_count", "Current JVM thread count."),
-		HeapUsedRatio:        desc("heap_used_ratio", "Current JVM heap usage ratio."),
-		HeapCommittedInBytes: desc("heap_committed_bytes", "Current JVM heap committed size"),
-		HeapUsedInBytes:      desc("heap_used_bytes", "Current JVM heap used size"),
-		PoolUsedBytes:        desc("memory_pool_used_bytes", "Current JVM heap pool used size", "pool"),
-		PoolCommittedBytes:   desc("memory_pool_committed_bytes", "Current JVM heap pool committed size", "pool"),
-		PoolMaxBytes:         desc("memory_pool_max_bytes", "Current JVM heap pool max size", "pool"),
+		ThreadsCount:         metric("threads", prometheus.GaugeValue, "Current JVM thread count."),
+		HeapUsedRatio:        metric("heap_used_ratio", prometheus.GaugeValue, "Current JVM heap usage ratio."),
+		HeapCommittedInBytes: metric("heap_committed_bytes", prometheus.GaugeValue, "Current JVM heap committed size"),
+		HeapUsedInBytes:      metric("heap_used_bytes", prometheus.GaugeValue, "Current JVM heap used size"),
+		PoolUsedBytes:        metric("memory_pool_used_bytes", prometheus.GaugeValue, "Current JVM heap pool used size", "pool"),
+		PoolCommittedBytes:   metric("memory_pool_committed_bytes", prometheus.GaugeValue, "Current JVM heap pool committed size", "pool"),
+		PoolMaxBytes:         metric("memory_pool_max_bytes", prometheus.GaugeValue, "Current JVM heap pool max size", "pool"),
 		GC:                   desc("gc_collection_duration_seconds", "GC collection duration.", "collector"),
+
+		errors: errors.WithLabelValues("jvm"),
 	}
 }
 
+func (c *JVMCollector) Describe(ch chan<- *prometheus.Desc) {
+	helpers.DescribeMetricDefs(ch, c.ThreadsCount, c.HeapUsedRatio, c.HeapCommittedInBytes, c.HeapUsedInBytes, c.PoolUsedBytes, c.PoolCommittedBytes, c.PoolMaxBytes)
+	ch <- c.GC
+}
+
 type jvmMetricData struct {
-	desc      *prometheus.Desc
-	valueType prometheus.ValueType
-	value     float64
-	labels    []string
+	def    helpers.MetricDef
+	value  float64
+	labels []string
 }
 
 func (c *JVMCollector) Collect(jvm JVM, ch chan<- prometheus.Metric) {
 
 	metrics := []jvmMetricData{
-		{c.ThreadsCount, prometheus.GaugeValue, float64(jvm.Threads.Count), nil},
-		{c.HeapUsedRatio, prometheus.GaugeValue, float64(jvm.Mem.HeapUsedPercent) / 100.0, nil},
-		{c.HeapCommittedInBytes, prometheus.GaugeValue, float64(jvm.Mem.HeapCommittedInBytes), nil},
-		{c.HeapUsedInBytes, prometheus.GaugeValue, float64(jvm.Mem.HeapUsedInBytes), nil},
+		{c.ThreadsCount, float64(jvm.Threads.Count), nil},
+		{c.HeapUsedRatio, float64(jvm.Mem.HeapUsedPercent) / 100.0, nil},
+		{c.HeapCommittedInBytes, float64(jvm.Mem.HeapCommittedInBytes), nil},
+		{c.HeapUsedInBytes, float64(jvm.Mem.HeapUsedInBytes), nil},
 	}
 
-	poolLabels := []string{"young", "survivor", "old"}
-	poolMetrics := []jvmMetricData{
-		{c.PoolUsedBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Young.UsedInBytes), []string{poolLabels[0]}},
-		{c.PoolUsedBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Survivor.UsedInBytes), []string{poolLabels[1]}},
-		{c.PoolUsedBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Old.UsedInBytes), []string{poolLabels[2]}},
-		{c.PoolCommittedBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Young.CommittedInBytes), []string{poolLabels[0]}},
-		{c.PoolCommittedBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Survivor.CommittedInBytes), []string{poolLabels[1]}},
-		{c.PoolCommittedBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Old.CommittedInBytes), []string{poolLabels[2]}},
-		{c.PoolMaxBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Young.MaxInBytes), []string{poolLabels[0]}},
-		{c.PoolMaxBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Survivor.MaxInBytes), []string{poolLabels[1]}},
-		{c.PoolMaxBytes, prometheus.GaugeValue, float64(jvm.Mem.Pools.Old.MaxInBytes), []string{poolLabels[2]}},
+	var poolMetrics []jvmMetricData
+	if pools := jvm.Mem.Pools; pools != nil {
+		poolLabels := []string{"young", "survivor", "old"}
+		poolMetrics = []jvmMetricData{
+			{c.PoolUsedBytes, float64(pools.Young.UsedInBytes), []string{poolLabels[0]}},
+			{c.PoolUsedBytes, float64(pools.Survivor.UsedInBytes), []string{poolLabels[1]}},
+			{c.PoolUsedBytes, float64(pools.Old.UsedInBytes), []string{poolLabels[2]}},
+			{c.PoolCommittedBytes, float64(pools.Young.CommittedInBytes), []string{poolLabels[0]}},
+			{c.PoolCommittedBytes, float64(pools.Survivor.CommittedInBytes), []string{poolLabels[1]}},
+			{c.PoolCommittedBytes, float64(pools.Old.CommittedInBytes), []string{poolLabels[2]}},
+			{c.PoolMaxBytes, float64(pools.Young.MaxInBytes), []string{poolLabels[0]}},
+			{c.PoolMaxBytes, float64(pools.Survivor.MaxInBytes), []string{poolLabels[1]}},
+			{c.PoolMaxBytes, float64(pools.Old.MaxInBytes), []string{poolLabels[2]}},
+		}
 	}
 
 	for _, m := range append(metrics, poolMetrics...) {
-		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value, m.labels...)
+		sendConstMetric(ch, c.errors, m.def, m.value, m.labels...)
 	}
 
-	ch <- prometheus.MustNewConstSummary(c.GC, jvm.GC.Collectors.Young.CollectionCount, float64(jvm.GC.Collectors.Young.CollectionTimeInMillis)/1000.0, nil, "young")
-	ch <- prometheus.MustNewConstSummary(c.GC, jvm.GC.Collectors.Old.CollectionCount, float64(jvm.GC.Collectors.Old.CollectionTimeInMillis)/1000.0, nil, "old")
+	sendConstSummary(ch, c.errors, c.GC, jvm.GC.Collectors.Young.CollectionCount, float64(jvm.GC.Collectors.Young.CollectionTimeInMillis)/1000.0, "young")
+	sendConstSummary(ch, c.errors, c.GC, jvm.GC.Collectors.Old.CollectionCount, float64(jvm.GC.Collectors.Old.CollectionTimeInMillis)/1000.0, "old")
 }
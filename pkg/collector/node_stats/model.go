@@ -1,5 +1,14 @@
 package node_stats
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 type NodeStats struct {
 	Host        string              `json:"host"`
 	Version     string              `json:"version"`
@@ -14,6 +23,85 @@ type NodeStats struct {
 	Process     Process             `json:"process"`
 	Event       Event               `json:"events"`
 	Pipelines   map[string]Pipeline `json:"pipelines"`
+	// Skipped holds the top-level fields left out by UnmarshalPartial, whose
+	// series must not be collected.
+	Skipped map[string]bool `json:"-"`
+}
+
+// UnmarshalPartial decodes a document holding values of unexpected types, field
+// by field and pipeline by pipeline. The fields and pipelines holding such
+// values are left out, the fields being recorded in Skipped.
+func (s *NodeStats) UnmarshalPartial(data []byte) ([]error, error) {
+	return unmarshalPartial(data, s, func(data []byte) (Pipeline, error) {
+		var pipeline Pipeline
+		err := json.Unmarshal(data, &pipeline)
+		return pipeline, err
+	})
+}
+
+func unmarshalPartial(data []byte, s *NodeStats, decodePipeline func(data []byte) (Pipeline, error)) ([]error, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	*s = NodeStats{}
+	var skipped []error
+	for _, name := range names {
+		if name == "pipelines" {
+			skipped = append(skipped, s.unmarshalPipelines(fields[name], decodePipeline)...)
+			continue
+		}
+
+		// Each field is decoded alone in a document of its own, so that a
+		// value of the wrong type only leaves out its field.
+		field, err := json.Marshal(map[string]json.RawMessage{name: fields[name]})
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(field, &NodeStats{}); err != nil {
+			s.skip(name)
+			skipped = append(skipped, err)
+			continue
+		}
+		if err := json.Unmarshal(field, s); err != nil {
+			return nil, err
+		}
+	}
+	return skipped, nil
+}
+
+func (s *NodeStats) skip(name string) {
+	if s.Skipped == nil {
+		s.Skipped = make(map[string]bool)
+	}
+	s.Skipped[name] = true
+}
+
+func (s *NodeStats) unmarshalPipelines(data []byte, decodePipeline func(data []byte) (Pipeline, error)) []error {
+	var pipelines map[string]json.RawMessage
+	if err := json.Unmarshal(data, &pipelines); err != nil {
+		s.skip("pipelines")
+		return []error{fmt.Errorf("pipelines: %w", err)}
+	}
+
+	var skipped []error
+	s.Pipelines = make(map[string]Pipeline, len(pipelines))
+	for name, data := range pipelines {
+		pipeline, err := decodePipeline(data)
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("pipeline %s: %w", name, err))
+			continue
+		}
+		s.Pipelines[name] = pipeline
+	}
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].Error() < skipped[j].Error() })
+	return skipped
 }
 
 type PipelineConfig struct {
@@ -121,6 +209,16 @@ type Pipeline struct {
 		ExpiredEvents       int    `json:"expired_events"`
 		QueueSizeInBytes    int    `json:"queue_size_in_bytes"`
 	} `json:"dead_letter_queue"`
+	// Flow is reported since Logstash 8.5.
+	Flow struct {
+		WorkerUtilization *FlowMetric `json:"worker_utilization"`
+	} `json:"flow"`
+}
+
+// FlowMetric is a rate reported in the flow section of a pipeline.
+type FlowMetric struct {
+	Current  float64 `json:"current"`
+	Lifetime float64 `json:"lifetime"`
 }
 
 type PluginEvents struct {
@@ -134,13 +232,28 @@ type InputPlugin struct {
 	ID                 string       `json:"id"`
 	Name               string       `json:"name"`
 	CurrentConnections int          `json:"current_connections"`
+	PeakConnections    *int         `json:"peak_connections,omitempty"`
 	Events             PluginEvents `json:"events"`
+	Fields             PluginFields `json:"-"`
+}
+
+// Metrics returns the plugin-specific numeric fields of the input.
+func (p *InputPlugin) Metrics() PluginMetrics {
+	return p.Fields.metrics("id", "name", "current_connections", "peak_connections", "events")
 }
 
 type FilterPlugin struct {
-	ID     string       `json:"id"`
-	Name   string       `json:"name"`
-	Events PluginEvents `json:"events"`
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Events   PluginEvents `json:"events"`
+	Matches  *int         `json:"matches,omitempty"`
+	Failures *int         `json:"failures,omitempty"`
+	Fields   PluginFields `json:"-"`
+}
+
+// Metrics returns the plugin-specific numeric fields of the filter.
+func (p *FilterPlugin) Metrics() PluginMetrics {
+	return p.Fields.metrics("id", "name", "events", "matches", "failures")
 }
 
 type OutputPlugin struct {
@@ -148,9 +261,279 @@ type OutputPlugin struct {
 	Name      string          `json:"name"`
 	Events    PluginEvents    `json:"events"`
 	Documents DocumentsEvents `json:"documents"`
+	Fields    PluginFields    `json:"-"`
+}
+
+// Metrics returns the plugin-specific numeric fields of the output.
+func (p *OutputPlugin) Metrics() PluginMetrics {
+	return p.Fields.metrics("id", "name", "events", "documents")
 }
 
 type DocumentsEvents struct {
 	Successes            int `json:"successes"`
 	NonRetryableFailures int `json:"non_retryable_failures,omitempty"`
 }
+
+// PluginFields holds the raw JSON object of a plugin entry. It is only kept when
+// decoding NodeStatsWithPluginFields, and its plugin-specific fields are only
+// decoded on demand.
+type PluginFields []byte
+
+// NodeStatsWithPluginFields decodes NodeStats keeping the Fields of every plugin
+// entry, which the plugin_metric series are built from. Decoding NodeStats
+// directly skips copying them when plugin metrics are disabled.
+type NodeStatsWithPluginFields NodeStats
+
+func (s *NodeStatsWithPluginFields) UnmarshalJSON(data []byte) error {
+	// The pipelines field shadows the one of the embedded NodeStats, so the
+	// document is decoded once with the plugins keeping their fields.
+	var stats struct {
+		NodeStats
+		Pipelines map[string]pipelineWithPluginFields `json:"pipelines"`
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return err
+	}
+
+	stats.NodeStats.Pipelines = make(map[string]Pipeline, len(stats.Pipelines))
+	for name, pipeline := range stats.Pipelines {
+		stats.NodeStats.Pipelines[name] = pipeline.pipeline()
+	}
+	*s = NodeStatsWithPluginFields(stats.NodeStats)
+	return nil
+}
+
+// UnmarshalPartial is NodeStats.UnmarshalPartial keeping the Fields of every plugin entry.
+func (s *NodeStatsWithPluginFields) UnmarshalPartial(data []byte) ([]error, error) {
+	return unmarshalPartial(data, (*NodeStats)(s), func(data []byte) (Pipeline, error) {
+		var pipeline pipelineWithPluginFields
+		err := json.Unmarshal(data, &pipeline)
+		return pipeline.pipeline(), err
+	})
+}
+
+type pipelineWithPluginFields struct {
+	Pipeline
+	Plugins struct {
+		Inputs  []inputPluginWithFields  `json:"inputs"`
+		Filters []filterPluginWithFields `json:"filters"`
+		Outputs []outputPluginWithFields `json:"outputs"`
+	} `json:"plugins"`
+}
+
+func (p pipelineWithPluginFields) pipeline() Pipeline {
+	pipeline := p.Pipeline
+	pipeline.Plugins.Inputs = make([]InputPlugin, len(p.Plugins.Inputs))
+	for i, plugin := range p.Plugins.Inputs {
+		pipeline.Plugins.Inputs[i] = InputPlugin(plugin)
+	}
+	pipeline.Plugins.Filters = make([]FilterPlugin, len(p.Plugins.Filters))
+	for i, plugin := range p.Plugins.Filters {
+		pipeline.Plugins.Filters[i] = FilterPlugin(plugin)
+	}
+	pipeline.Plugins.Outputs = make([]OutputPlugin, len(p.Plugins.Outputs))
+	for i, plugin := range p.Plugins.Outputs {
+		pipeline.Plugins.Outputs[i] = OutputPlugin(plugin)
+	}
+	return pipeline
+}
+
+type inputPluginWithFields InputPlugin
+
+func (p *inputPluginWithFields) UnmarshalJSON(data []byte) error {
+	p.Fields = append(p.Fields[:0], data...)
+	return json.Unmarshal(data, (*InputPlugin)(p))
+}
+
+type filterPluginWithFields FilterPlugin
+
+func (p *filterPluginWithFields) UnmarshalJSON(data []byte) error {
+	p.Fields = append(p.Fields[:0], data...)
+	return json.Unmarshal(data, (*FilterPlugin)(p))
+}
+
+type outputPluginWithFields OutputPlugin
+
+func (p *outputPluginWithFields) UnmarshalJSON(data []byte) error {
+	p.Fields = append(p.Fields[:0], data...)
+	return json.Unmarshal(data, (*OutputPlugin)(p))
+}
+
+// PluginMetrics holds the plugin-specific numeric fields of a plugin entry that
+// have no dedicated struct field, keyed by their dotted JSON path
+// (e.g. "bulk_requests.with_errors" or "bulk_requests.responses.200").
+type PluginMetrics map[string]float64
+
+func (f PluginFields) metrics(known ...string) PluginMetrics {
+	m := PluginMetrics{}
+	w := fieldsWalker{data: f}
+	if !w.object("", known, m) {
+		return nil
+	}
+	return m
+}
+
+// fieldsWalker walks the tokens of the JSON object of a plugin entry, recording
+// its numbers without decoding the rest of the object into maps and interfaces.
+// The object was validated when the node stats were decoded.
+type fieldsWalker struct {
+	data []byte
+	pos  int
+}
+
+// object walks the object at the current position, recording the numbers of
+// its fields, except those named skip, under their dotted path from prefix.
+func (w *fieldsWalker) object(prefix string, skip []string, m PluginMetrics) bool {
+	if w.next() != '{' {
+		return false
+	}
+	w.pos++
+	if w.next() == '}' {
+		w.pos++
+		return true
+	}
+
+	for {
+		key, ok := w.key()
+		if !ok || w.next() != ':' {
+			return false
+		}
+		w.pos++
+
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if !contains(skip, key) && !w.value(key, m) || contains(skip, key) && !w.skipValue() {
+			return false
+		}
+
+		switch w.next() {
+		case ',':
+			w.pos++
+		case '}':
+			w.pos++
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// value records the number at the current position under key, walking objects
+// and skipping any other value.
+func (w *fieldsWalker) value(key string, m PluginMetrics) bool {
+	switch c := w.next(); {
+	case c == '{':
+		return w.object(key, nil, m)
+	case c == '-' || c >= '0' && c <= '9':
+		start := w.pos
+		w.skipNumber()
+		value, err := strconv.ParseFloat(string(w.data[start:w.pos]), 64)
+		if err != nil {
+			return false
+		}
+		m[key] = value
+		return true
+	default:
+		return w.skipValue()
+	}
+}
+
+// key returns the object key at the current position.
+func (w *fieldsWalker) key() (string, bool) {
+	if w.next() != '"' {
+		return "", false
+	}
+	start := w.pos
+	if !w.skipString() {
+		return "", false
+	}
+	raw := w.data[start:w.pos]
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw[1 : len(raw)-1]), true
+	}
+
+	var key string
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// skipValue moves past the value at the current position.
+func (w *fieldsWalker) skipValue() bool {
+	switch c := w.next(); {
+	case c == '"':
+		return w.skipString()
+	case c == '{' || c == '[':
+		depth := 0
+		for w.pos < len(w.data) {
+			switch w.data[w.pos] {
+			case '"':
+				if !w.skipString() {
+					return false
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			w.pos++
+			if depth == 0 {
+				return true
+			}
+		}
+		return false
+	case c == '-' || c >= '0' && c <= '9':
+		w.skipNumber()
+		return true
+	default:
+		// true, false or null
+		for w.pos < len(w.data) && w.data[w.pos] >= 'a' && w.data[w.pos] <= 'z' {
+			w.pos++
+		}
+		return true
+	}
+}
+
+func (w *fieldsWalker) skipString() bool {
+	for w.pos++; w.pos < len(w.data); w.pos++ {
+		switch w.data[w.pos] {
+		case '\\':
+			w.pos++
+		case '"':
+			w.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (w *fieldsWalker) skipNumber() {
+	for w.pos < len(w.data) && strings.IndexByte("+-.0123456789eE", w.data[w.pos]) >= 0 {
+		w.pos++
+	}
+}
+
+// next skips whitespace and returns the byte at the current position, 0 at the end.
+func (w *fieldsWalker) next() byte {
+	for w.pos < len(w.data) {
+		switch w.data[w.pos] {
+		case ' ', '\t', '\n', '\r':
+			w.pos++
+		default:
+			return w.data[w.pos]
+		}
+	}
+	return 0
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package node_stats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"prom-logstash-exporter/pkg/restclient"
+)
+
+func readFixture(tb testing.TB, name string) []byte {
+	tb.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// largeNodeStats returns the node_stats.json fixture with its main pipeline
+// repeated n times, the size of the documents of nodes running many pipelines.
+func largeNodeStats(tb testing.TB, n int) []byte {
+	tb.Helper()
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(readFixture(tb, "node_stats.json"), &doc); err != nil {
+		tb.Fatal(err)
+	}
+	var pipelines map[string]json.RawMessage
+	if err := json.Unmarshal(doc["pipelines"], &pipelines); err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		pipelines["main_"+strconv.Itoa(i)] = pipelines["main"]
+	}
+
+	var err error
+	if doc["pipelines"], err = json.Marshal(pipelines); err != nil {
+		tb.Fatal(err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// bodyHandler serves its content as the body of every response.
+type bodyHandler []byte
+
+func (h bodyHandler) Get(context.Context, string) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(h))}, nil
+}
+
+func TestNodeStatsWithPluginFields(t *testing.T) {
+	data := readFixture(t, "node_stats.json")
+
+	var stats NodeStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if fields := stats.Pipelines["main"].Plugins.Outputs[0].Fields; fields != nil {
+		t.Errorf("NodeStats kept the plugin fields: %s", fields)
+	}
+
+	if err := json.Unmarshal(data, (*NodeStatsWithPluginFields)(&stats)); err != nil {
+		t.Fatal(err)
+	}
+	metrics := stats.Pipelines["main"].Plugins.Outputs[0].Metrics()
+	if got := metrics["bulk_requests.responses.200"]; got != 12343 {
+		t.Errorf("bulk_requests.responses.200 = %v, want 12343", got)
+	}
+	if _, ok := metrics["events.in"]; ok {
+		t.Errorf("plugin metrics include the known events field: %v", metrics)
+	}
+}
+
+func TestPluginFieldsMetrics(t *testing.T) {
+	fields := PluginFields(`{
+		"id": "es_out",
+		"events": {"in": 3},
+		"bulk_requests": {"responses": {"200": 12, "429": 1}, "with_errors": 1},
+		"escaped\"key": 2,
+		"quoted": "not {a} number",
+		"list": [1, {"nested": 2}],
+		"enabled": true,
+		"last_error": null,
+		"ratio": -1.5e-1,
+		"empty": {}
+	}`)
+
+	want := PluginMetrics{
+		"bulk_requests.responses.200": 12,
+		"bulk_requests.responses.429": 1,
+		"bulk_requests.with_errors":   1,
+		`escaped"key`:                 2,
+		"ratio":                       -0.15,
+	}
+	if got := fields.metrics("id", "events"); !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics = %v, want %v", got, want)
+	}
+
+	if got := PluginFields(`["not", "an", "object"]`).metrics(); got != nil {
+		t.Errorf("metrics of an array = %v, want nil", got)
+	}
+}
+
+// BenchmarkDecodeNodeStats measures decoding a large node stats document the
+// way the exporter does, with and without keeping the plugin fields needed by
+// the plugin_metric series.
+func BenchmarkDecodeNodeStats(b *testing.B) {
+	data := largeNodeStats(b, 50)
+
+	for _, bench := range []struct {
+		name   string
+		target func(stats *NodeStats) interface{}
+	}{
+		{"plugin_fields", func(stats *NodeStats) interface{} { return (*NodeStatsWithPluginFields)(stats) }},
+		{"no_plugin_fields", func(stats *NodeStats) interface{} { return stats }},
+	} {
+		bench := bench
+		b.Run(bench.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var stats NodeStats
+				if _, err := restclient.GetMetricsWithStats(context.Background(), bodyHandler(data), "", bench.target(&stats)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -4,88 +4,242 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"prom-logstash-exporter/constants"
 	"prom-logstash-exporter/pkg/helpers"
+	"regexp"
+	"sort"
 	"strconv"
 )
 
 type PipelinesCollector struct {
-	In                *prometheus.Desc
-	Filtered          *prometheus.Desc
-	Out               *prometheus.Desc
-	Duration          *prometheus.Desc
-	QueuePushDuration *prometheus.Desc
-
-	InputConnections       *prometheus.Desc
-	InputQueuePushDuration *prometheus.Desc
-	InputOut               *prometheus.Desc
-
-	FilterDuration *prometheus.Desc
-	FilterIn       *prometheus.Desc
-	FilterOut      *prometheus.Desc
-
-	OutputDuration             *prometheus.Desc
-	OutputIn                   *prometheus.Desc
-	OutputOut                  *prometheus.Desc
-	OutputSuccesses            *prometheus.Desc
-	OutputNonRetryableFailures *prometheus.Desc
-
-	EventsCount  *prometheus.Desc
-	QueueSize    *prometheus.Desc
-	MaxQueueSize *prometheus.Desc
-
-	CapacityMaxUnreadEvents     *prometheus.Desc
-	CapacityMaxQueueSizeInBytes *prometheus.Desc
-	CapacityPageCapacityInBytes *prometheus.Desc
-	CapacityQueueSizeInBytes    *prometheus.Desc
+	In                helpers.MetricDef
+	Filtered          helpers.MetricDef
+	Out               helpers.MetricDef
+	Duration          helpers.MetricDef
+	QueuePushDuration helpers.MetricDef
+
+	InputConnections       helpers.MetricDef
+	InputPeakConnections   helpers.MetricDef
+	InputQueuePushDuration helpers.MetricDef
+	InputIn                helpers.MetricDef
+	InputOut               helpers.MetricDef
+
+	FilterDuration helpers.MetricDef
+	FilterIn       helpers.MetricDef
+	FilterOut      helpers.MetricDef
+	FilterMatches  helpers.MetricDef
+	FilterFailures helpers.MetricDef
+
+	OutputDuration             helpers.MetricDef
+	OutputIn                   helpers.MetricDef
+	OutputOut                  helpers.MetricDef
+	OutputSuccesses            helpers.MetricDef
+	OutputNonRetryableFailures helpers.MetricDef
+
+	EventsCount  helpers.MetricDef
+	QueueSize    helpers.MetricDef
+	MaxQueueSize helpers.MetricDef
+
+	CapacityMaxUnreadEvents     helpers.MetricDef
+	CapacityMaxQueueSizeInBytes helpers.MetricDef
+	CapacityPageCapacityInBytes helpers.MetricDef
+	CapacityQueueSizeInBytes    helpers.MetricDef
 
 	//DeadLetterQueue
-	DroppedEvents              *prometheus.Desc
-	MaxQueueSizeInBytes        *prometheus.Desc
-	DeadLetterQueueSizeInBytes *prometheus.Desc
+	DroppedEvents              helpers.MetricDef
+	MaxQueueSizeInBytes        helpers.MetricDef
+	DeadLetterQueueSizeInBytes helpers.MetricDef
+
+	WorkerUtilization helpers.MetricDef
+
+	PluginMetric helpers.MetricDef
+
+	// DuplicatePlugins counts plugin entries skipped because another plugin of
+	// the same type in the same pipeline already reported the same ID.
+	DuplicatePlugins *prometheus.CounterVec
+	// SeriesDropped counts the plugin series dropped once the MaxPluginSeries option is reached.
+	SeriesDropped prometheus.Counter
+	// FilteredObjects counts the pipelines and plugins skipped by the Filter option.
+	FilteredObjects *prometheus.CounterVec
+
+	options PipelinesCollectorOptions
+	errors  prometheus.Counter
+}
+
+// PipelinesCollectorOptions configures the optional behaviour of the PipelinesCollector.
+type PipelinesCollectorOptions struct {
+	// PluginMetrics enables the generic plugin_metric series built from the
+	// plugin-specific numeric fields of every plugin entry.
+	PluginMetrics bool
+	// PluginMetricKeys restricts the generic plugin_metric series to these keys.
+	// An empty list allows every key.
+	PluginMetricKeys []string
+	// Filter selects the pipelines and plugins series are built for.
+	Filter PipelinesFilter
+	// MaxPluginSeries caps the number of plugin series sent per scrape, 0 disables the cap.
+	MaxPluginSeries int
+	// ReplaceGeneratedIDs labels plugins whose ID was generated by Logstash with
+	// their name and position instead, as generated IDs change on every config edit.
+	ReplaceGeneratedIDs bool
+}
+
+// generatedPluginID matches the hexadecimal hashes Logstash uses as ID of the
+// plugins configured without an explicit id.
+var generatedPluginID = regexp.MustCompile(`^[0-9a-f]{32,}$`)
+
+// pluginIDs resolves the ID label of the plugins of a pipeline.
+type pluginIDs struct {
+	replaceGenerated bool
+	// occurrences counts the plugins with a generated ID seen so far, by type and name.
+	occurrences map[string]int
+}
+
+// pluginID returns id, or when id was generated by Logstash, name and the
+// zero-based position of the plugin among the plugins of the pipeline with the
+// same type and name and a generated ID, in the order Logstash lists them
+// (e.g. "mutate_1" for the second mutate filter without an explicit id).
+// Plugins with an explicit id are not counted.
+func (p pluginIDs) pluginID(pluginType, id, name string) string {
+	if !p.replaceGenerated || !generatedPluginID.MatchString(id) {
+		return id
+	}
+
+	key := pluginType + "/" + name
+	position := p.occurrences[key]
+	p.occurrences[key]++
+	return name + "_" + strconv.Itoa(position)
 }
 
-func NewPipelinesCollector() *PipelinesCollector {
-	desc := helpers.NewDescFQ(constants.Namespace, "pipeline")
+func NewPipelinesCollector(options PipelinesCollectorOptions, errors *prometheus.CounterVec, naming helpers.Naming, constLabels prometheus.Labels) *PipelinesCollector {
+	metric := naming.NewMetricDefFQ(constants.Namespace, "pipeline", constLabels)
 	return &PipelinesCollector{
-		In:                desc("event_in_total", "The total number of events in.", "pipeline"),
-		Filtered:          desc("event_filtered_total", "The total numbers of filtered.", "pipeline"),
-		Out:               desc("event_out_total", "The total number of events out.", "pipeline"),
-		Duration:          desc("event_duration_seconds_total", "The total process duration time in seconds.", "pipeline"),
-		QueuePushDuration: desc("event_queue_push_duration_seconds_total", "The total in queue duration time in seconds.", "pipeline"),
+		In:                metric("event_in_total", prometheus.CounterValue, "The total number of events in.", "pipeline"),
+		Filtered:          metric("event_filtered_total", prometheus.CounterValue, "The total numbers of filtered.", "pipeline"),
+		Out:               metric("event_out_total", prometheus.CounterValue, "The total number of events out.", "pipeline"),
+		Duration:          metric("event_duration_seconds_total", prometheus.CounterValue, "The total process duration time in seconds.", "pipeline"),
+		QueuePushDuration: metric("event_queue_push_duration_seconds_total", prometheus.CounterValue, "The total in queue duration time in seconds.", "pipeline"),
+
+		InputConnections:       metric("input_connections", prometheus.GaugeValue, "The current number of connections.", "pipeline", "id", "name"),
+		InputPeakConnections:   metric("input_peak_connections", prometheus.GaugeValue, "The peak number of connections.", "pipeline", "id", "name"),
+		InputQueuePushDuration: metric("input_queue_push_seconds_total", prometheus.CounterValue, "The total in queue duration time in seconds", "pipeline", "id", "name"),
+		InputIn:                metric("input_in_total", prometheus.CounterValue, "The total number of events received by the input.", "pipeline", "id", "name"),
+		InputOut:               metric("input_out_total", prometheus.CounterValue, "The total number of events out.", "pipeline", "id", "name"),
+
+		FilterDuration: metric("filter_duration_seconds_total", prometheus.CounterValue, "The total process duration time in seconds", "pipeline", "id", "name"),
+		FilterIn:       metric("filter_in_total", prometheus.CounterValue, "The total number of events in.", "pipeline", "id", "name"),
+		FilterOut:      metric("filter_out_total", prometheus.CounterValue, "The total number of events out.", "pipeline", "id", "name"),
+		FilterMatches:  metric("filter_matches_total", prometheus.CounterValue, "The total number of events matched by a grok or dissect filter.", "pipeline", "id", "name"),
+		FilterFailures: metric("filter_failures_total", prometheus.CounterValue, "The total number of events a grok or dissect filter failed to match.", "pipeline", "id", "name"),
 
-		InputConnections:       desc("input_connections", "The current number of connections.", "pipeline", "id", "name"),
-		InputQueuePushDuration: desc("input_queue_push_seconds_total", "The total in queue duration time in seconds", "pipeline", "id", "name"),
-		InputOut:               desc("input_out_total", "The total number of events out.", "pipeline", "id", "name"),
+		OutputDuration:             metric("output_duration_seconds_total", prometheus.CounterValue, "The total process duration time in seconds", "pipeline", "id", "name"),
+		OutputIn:                   metric("output_in_total", prometheus.CounterValue, "The total number of events in.", "pipeline", "id", "name"),
+		OutputOut:                  metric("output_out_total", prometheus.CounterValue, "The total number of events out.", "pipeline", "id", "name"),
+		OutputSuccesses:            metric("output_successes_total", prometheus.CounterValue, "The total number of successful outputs.", "pipeline", "id", "name"),
+		OutputNonRetryableFailures: metric("output_non_retryable_failures_total", prometheus.CounterValue, "The total number of non-retryable output failures.", "pipeline", "id", "name"),
 
-		FilterDuration: desc("filter_duration_seconds_total", "The total process duration time in seconds", "pipeline", "id", "name", "index"),
-		FilterIn:       desc("filter_in_total", "The total number of events in.", "pipeline", "id", "name", "index"),
-		FilterOut:      desc("filter_out_total", "The total number of events out.", "pipeline", "id", "name", "index"),
+		EventsCount:  metric("queue_events", prometheus.GaugeValue, "The current events in queue.", "pipeline", "queue_type"),
+		QueueSize:    metric("queue_size_bytes", prometheus.GaugeValue, "The current queue size in bytes.", "pipeline", "queue_type"),
+		MaxQueueSize: metric("queue_max_size_bytes", prometheus.GaugeValue, "The max queue size in bytes.", "pipeline", "queue_type"),
 
-		OutputDuration:             desc("output_duration_seconds_total", "The total process duration time in seconds", "pipeline", "id", "name"),
-		OutputIn:                   desc("output_in_total", "The total number of events in.", "pipeline", "id", "name"),
-		OutputOut:                  desc("output_out_total", "The total number of events out.", "pipeline", "id", "name"),
-		OutputSuccesses:            desc("output_successes_total", "The total number of successful outputs.", "pipeline", "id", "name"),
-		OutputNonRetryableFailures: desc("output_non_retryable_failures_total", "The total number of non-retryable output failures.", "pipeline", "id", "name"),
+		CapacityMaxUnreadEvents:     metric("capacity_max_unread_events", prometheus.GaugeValue, "The maximum number of unread events in capacity.", "pipeline", "queue_type"),
+		CapacityMaxQueueSizeInBytes: metric("capacity_max_queue_size_bytes", prometheus.GaugeValue, "The maximum size of the capacity queue in bytes.", "pipeline", "queue_type"),
+		CapacityPageCapacityInBytes: metric("page_capacity_bytes", prometheus.GaugeValue, "The capacity of a single page in bytes.", "pipeline", "queue_type"),
+		CapacityQueueSizeInBytes:    metric("capacity_queue_size_bytes", prometheus.GaugeValue, "The current size of the queue capacity in bytes.", "pipeline", "queue_type"),
 
-		EventsCount:  desc("queue_event_count", "The current events in queue.", "pipeline", "queue_type"),
-		QueueSize:    desc("queue_size_bytes", "The current queue size in bytes.", "pipeline", "queue_type"),
-		MaxQueueSize: desc("queue_max_size_bytes", "The max queue size in bytes.", "pipeline", "queue_type"),
+		DroppedEvents:              metric("dead_letter_queue_dropped_events_total", prometheus.CounterValue, "The total number of dropped events in the dead letter queue.", "pipeline"),
+		MaxQueueSizeInBytes:        metric("dead_letter_queue_max_queue_size_bytes", prometheus.GaugeValue, "The maximum size of the dead letter queue in bytes.", "pipeline"),
+		DeadLetterQueueSizeInBytes: metric("dead_letter_queue_size_bytes", prometheus.GaugeValue, "The current size of the dead letter queue in bytes.", "pipeline"),
 
-		CapacityMaxUnreadEvents:     desc("capacity_max_unread_events", "The maximum number of unread events in capacity.", "pipeline", "queue_type"),
-		CapacityMaxQueueSizeInBytes: desc("capacity_max_queue_size_bytes", "The maximum size of the capacity queue in bytes.", "pipeline", "queue_type"),
-		CapacityPageCapacityInBytes: desc("page_capacity_bytes", "The capacity of a single page in bytes.", "pipeline", "queue_type"),
-		CapacityQueueSizeInBytes:    desc("capacity_queue_size_bytes", "The current size of the queue capacity in bytes.", "pipeline", "queue_type"),
+		WorkerUtilization: metric("worker_utilization_ratio", prometheus.GaugeValue, "The current ratio of the time the pipeline workers spent processing events.", "pipeline"),
 
-		DroppedEvents:              desc("dead_letter_queue_dropped_events_total", "The total number of dropped events in the dead letter queue.", "pipeline"),
-		MaxQueueSizeInBytes:        desc("dead_letter_queue_max_queue_size_bytes", "The maximum size of the dead letter queue in bytes.", "pipeline"),
-		DeadLetterQueueSizeInBytes: desc("dead_letter_queue_size_bytes", "The current size of the dead letter queue in bytes.", "pipeline"),
+		PluginMetric: metric("plugin_metric", prometheus.UntypedValue, "A plugin-specific numeric field reported by the plugin.", "pipeline", "plugin_type", "id", "name", "key"),
+
+		DuplicatePlugins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_duplicate_plugins_total",
+			Help:        "Number of plugin entries skipped because their ID was already reported in the same pipeline.",
+			ConstLabels: constLabels,
+		}, []string{"pipeline", "plugin_type"}),
+		FilteredObjects: newFilteredObjects(constLabels),
+		SeriesDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   constants.Namespace,
+			Name:        "exporter_series_dropped_total",
+			Help:        "Number of plugin series dropped because the plugin series limit was reached.",
+			ConstLabels: constLabels,
+		}),
+
+		options: options,
+		errors:  errors.WithLabelValues("pipelines"),
 	}
 }
 
+func (c *PipelinesCollector) Describe(ch chan<- *prometheus.Desc) {
+	helpers.DescribeMetricDefs(ch, c.In, c.Filtered, c.Out, c.Duration, c.QueuePushDuration,
+		c.InputConnections, c.InputPeakConnections, c.InputQueuePushDuration, c.InputIn, c.InputOut,
+		c.FilterDuration, c.FilterIn, c.FilterOut, c.FilterMatches, c.FilterFailures,
+		c.OutputDuration, c.OutputIn, c.OutputOut, c.OutputSuccesses, c.OutputNonRetryableFailures,
+		c.EventsCount, c.QueueSize, c.MaxQueueSize,
+		c.CapacityMaxUnreadEvents, c.CapacityMaxQueueSizeInBytes, c.CapacityPageCapacityInBytes, c.CapacityQueueSizeInBytes,
+		c.DroppedEvents, c.MaxQueueSizeInBytes, c.DeadLetterQueueSizeInBytes,
+		c.WorkerUtilization, c.PluginMetric,
+	)
+	c.DuplicatePlugins.Describe(ch)
+	c.FilteredObjects.Describe(ch)
+	ch <- c.SeriesDropped.Desc()
+}
+
 type pipelineMetricData struct {
-	desc      *prometheus.Desc
-	valueType prometheus.ValueType
-	value     float64
-	labels    []string
+	def    helpers.MetricDef
+	value  float64
+	labels []string
+}
+
+func newFilteredObjects(constLabels prometheus.Labels) *prometheus.CounterVec {
+	filtered := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   constants.Namespace,
+		Name:        "exporter_filtered_objects_total",
+		Help:        "Number of pipelines and plugins skipped by the include/exclude filters.",
+		ConstLabels: constLabels,
+	}, []string{"object"})
+	filtered.WithLabelValues("pipeline")
+	filtered.WithLabelValues("plugin")
+	return filtered
+}
+
+// Filter returns the pipelines and plugins allowed by the Filter option, counting
+// the skipped ones. It is applied once per scrape, before any series is built.
+func (c *PipelinesCollector) Filter(p map[string]Pipeline) map[string]Pipeline {
+	filter := c.options.Filter
+	if filter.PipelineInclude == nil && filter.PipelineExclude == nil && !filter.filtersPlugins() {
+		return p
+	}
+
+	filtered := make(map[string]Pipeline, len(p))
+	for pipelineName, pipeline := range p {
+		if !filter.pipelineAllowed(pipelineName) {
+			c.FilteredObjects.WithLabelValues("pipeline").Inc()
+			continue
+		}
+
+		if filter.filtersPlugins() {
+			pipeline.Plugins.Inputs = filterPlugins(c, pipeline.Plugins.Inputs, func(p InputPlugin) bool { return filter.pluginAllowed(p.ID, p.Name) })
+			pipeline.Plugins.Filters = filterPlugins(c, pipeline.Plugins.Filters, func(p FilterPlugin) bool { return filter.pluginAllowed(p.ID, p.Name) })
+			pipeline.Plugins.Outputs = filterPlugins(c, pipeline.Plugins.Outputs, func(p OutputPlugin) bool { return filter.pluginAllowed(p.ID, p.Name) })
+		}
+		filtered[pipelineName] = pipeline
+	}
+
+	return filtered
+}
+
+func filterPlugins[T any](c *PipelinesCollector, plugins []T, allowed func(T) bool) []T {
+	kept := make([]T, 0, len(plugins))
+	for _, plugin := range plugins {
+		if !allowed(plugin) {
+			c.FilteredObjects.WithLabelValues("plugin").Inc()
+			continue
+		}
+		kept = append(kept, plugin)
+	}
+	return kept
 }
 
 func (c *PipelinesCollector) Collect(p map[string]Pipeline, ch chan<- prometheus.Metric) {
@@ -94,60 +248,173 @@ func (c *PipelinesCollector) Collect(p map[string]Pipeline, ch chan<- prometheus
 	}
 }
 
+// CollectPlugins sends the per-plugin series of every pipeline. Once the
+// MaxPluginSeries option is reached, the remaining series are dropped and counted.
+// Pipelines are visited in name order, their plugins in the order Logstash
+// reports them and plugin metric keys in key order, so the same series are kept
+// every scrape.
+func (c *PipelinesCollector) CollectPlugins(p map[string]Pipeline, ch chan<- prometheus.Metric) {
+	pipelineNames := make([]string, 0, len(p))
+	for pipelineName := range p {
+		pipelineNames = append(pipelineNames, pipelineName)
+	}
+	sort.Strings(pipelineNames)
+
+	sent := 0
+	for _, pipelineName := range pipelineNames {
+		for _, m := range c.pluginMetricsForPipeline(pipelineName, p[pipelineName]) {
+			if c.options.MaxPluginSeries > 0 && sent >= c.options.MaxPluginSeries {
+				c.SeriesDropped.Inc()
+				continue
+			}
+			sendConstMetric(ch, c.errors, m.def, m.value, m.labels...)
+			sent++
+		}
+	}
+}
+
 func (c *PipelinesCollector) collectMetricsForPipeline(pipelineName string, p Pipeline, ch chan<- prometheus.Metric) {
 	eventMetrics := []pipelineMetricData{
-		{c.In, prometheus.CounterValue, float64(p.Event.In), []string{pipelineName}},
-		{c.Filtered, prometheus.CounterValue, float64(p.Event.Filtered), []string{pipelineName}},
-		{c.Out, prometheus.CounterValue, float64(p.Event.Out), []string{pipelineName}},
-		{c.Duration, prometheus.CounterValue, float64(p.Event.DurationInMillis) / 1000.0, []string{pipelineName}},
-		{c.QueuePushDuration, prometheus.CounterValue, float64(p.Event.QueuePushDurationInMillis) / 1000.0, []string{pipelineName}},
+		{c.In, float64(p.Event.In), []string{pipelineName}},
+		{c.Filtered, float64(p.Event.Filtered), []string{pipelineName}},
+		{c.Out, float64(p.Event.Out), []string{pipelineName}},
+		{c.Duration, float64(p.Event.DurationInMillis) / 1000.0, []string{pipelineName}},
+		{c.QueuePushDuration, float64(p.Event.QueuePushDurationInMillis) / 1000.0, []string{pipelineName}},
 	}
 
 	queueMetrics := []pipelineMetricData{
-		{c.EventsCount, prometheus.GaugeValue, float64(p.Queue.EventsCount), []string{pipelineName, p.Queue.Type}},
-		{c.QueueSize, prometheus.CounterValue, float64(p.Queue.QueueSizeInBytes), []string{pipelineName, p.Queue.Type}},
-		{c.MaxQueueSize, prometheus.CounterValue, float64(p.Queue.MaxQueueSizeInBytes), []string{pipelineName, p.Queue.Type}},
-		{c.CapacityMaxUnreadEvents, prometheus.CounterValue, float64(p.Queue.Capacity.MaxUnreadEvents), []string{pipelineName, p.Queue.Type}},
-		{c.CapacityMaxQueueSizeInBytes, prometheus.CounterValue, float64(p.Queue.Capacity.MaxQueueSizeInBytes), []string{pipelineName, p.Queue.Type}},
-		{c.CapacityPageCapacityInBytes, prometheus.CounterValue, float64(p.Queue.Capacity.PageCapacityInBytes), []string{pipelineName, p.Queue.Type}},
-		{c.CapacityQueueSizeInBytes, prometheus.CounterValue, float64(p.Queue.Capacity.QueueSizeInBytes), []string{pipelineName, p.Queue.Type}},
+		{c.EventsCount, float64(p.Queue.EventsCount), []string{pipelineName, p.Queue.Type}},
+		{c.QueueSize, float64(p.Queue.QueueSizeInBytes), []string{pipelineName, p.Queue.Type}},
+		{c.MaxQueueSize, float64(p.Queue.MaxQueueSizeInBytes), []string{pipelineName, p.Queue.Type}},
+		{c.CapacityMaxUnreadEvents, float64(p.Queue.Capacity.MaxUnreadEvents), []string{pipelineName, p.Queue.Type}},
+		{c.CapacityMaxQueueSizeInBytes, float64(p.Queue.Capacity.MaxQueueSizeInBytes), []string{pipelineName, p.Queue.Type}},
+		{c.CapacityPageCapacityInBytes, float64(p.Queue.Capacity.PageCapacityInBytes), []string{pipelineName, p.Queue.Type}},
+		{c.CapacityQueueSizeInBytes, float64(p.Queue.Capacity.QueueSizeInBytes), []string{pipelineName, p.Queue.Type}},
 	}
 
 	deadLetterQueueMetrics := []pipelineMetricData{
-		{c.DroppedEvents, prometheus.CounterValue, float64(p.DeadLetterQueue.DroppedEvents), []string{pipelineName}},
-		{c.MaxQueueSizeInBytes, prometheus.CounterValue, float64(p.DeadLetterQueue.MaxQueueSizeInBytes), []string{pipelineName}},
-		{c.DeadLetterQueueSizeInBytes, prometheus.CounterValue, float64(p.DeadLetterQueue.QueueSizeInBytes), []string{pipelineName}},
+		{c.DroppedEvents, float64(p.DeadLetterQueue.DroppedEvents), []string{pipelineName}},
+		{c.MaxQueueSizeInBytes, float64(p.DeadLetterQueue.MaxQueueSizeInBytes), []string{pipelineName}},
+		{c.DeadLetterQueueSizeInBytes, float64(p.DeadLetterQueue.QueueSizeInBytes), []string{pipelineName}},
+	}
+
+	metrics := append(append(eventMetrics, queueMetrics...), deadLetterQueueMetrics...)
+	if p.Flow.WorkerUtilization != nil {
+		metrics = append(metrics, pipelineMetricData{c.WorkerUtilization, p.Flow.WorkerUtilization.Current / 100.0, []string{pipelineName}})
 	}
-	var inputMetrics, filterMetrics, outputMetrics []pipelineMetricData
+
+	for _, m := range metrics {
+		sendConstMetric(ch, c.errors, m.def, m.value, m.labels...)
+	}
+}
+
+func (c *PipelinesCollector) pluginMetricsForPipeline(pipelineName string, p Pipeline) []pipelineMetricData {
+	var inputMetrics, filterMetrics, outputMetrics, pluginMetrics []pipelineMetricData
+
+	seen := make(map[string]struct{})
+	ids := pluginIDs{replaceGenerated: c.options.ReplaceGeneratedIDs, occurrences: make(map[string]int)}
 
 	for _, plugin := range p.Plugins.Inputs {
+		id := ids.pluginID("input", plugin.ID, plugin.Name)
+		if !c.firstOccurrence(seen, pipelineName, "input", id) {
+			continue
+		}
 		inputMetrics = append(inputMetrics,
-			pipelineMetricData{c.InputConnections, prometheus.GaugeValue, float64(plugin.CurrentConnections), []string{pipelineName, plugin.ID, plugin.Name}},
-			pipelineMetricData{c.InputQueuePushDuration, prometheus.CounterValue, float64(plugin.Events.QueuePushDurationInMillis) / 1000.0, []string{pipelineName, plugin.ID, plugin.Name}},
-			pipelineMetricData{c.InputOut, prometheus.CounterValue, float64(plugin.Events.Out), []string{pipelineName, plugin.ID, plugin.Name}},
+			pipelineMetricData{c.InputConnections, float64(plugin.CurrentConnections), []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.InputQueuePushDuration, float64(plugin.Events.QueuePushDurationInMillis) / 1000.0, []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.InputIn, float64(plugin.Events.In), []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.InputOut, float64(plugin.Events.Out), []string{pipelineName, id, plugin.Name}},
 		)
+		if plugin.PeakConnections != nil {
+			inputMetrics = append(inputMetrics, pipelineMetricData{c.InputPeakConnections, float64(*plugin.PeakConnections), []string{pipelineName, id, plugin.Name}})
+		}
+		if c.options.PluginMetrics {
+			pluginMetrics = c.appendPluginMetrics(pluginMetrics, pipelineName, "input", id, plugin.Name, plugin.Metrics())
+		}
 	}
 
-	for idx, plugin := range p.Plugins.Filters {
-		index := strconv.Itoa(idx)
+	for _, plugin := range p.Plugins.Filters {
+		id := ids.pluginID("filter", plugin.ID, plugin.Name)
+		if !c.firstOccurrence(seen, pipelineName, "filter", id) {
+			continue
+		}
 		filterMetrics = append(filterMetrics,
-			pipelineMetricData{c.FilterDuration, prometheus.CounterValue, float64(plugin.Events.DurationInMillis) / 1000.0, []string{pipelineName, plugin.ID, plugin.Name, index}},
-			pipelineMetricData{c.FilterIn, prometheus.CounterValue, float64(plugin.Events.In), []string{pipelineName, plugin.ID, plugin.Name, index}},
-			pipelineMetricData{c.FilterOut, prometheus.CounterValue, float64(plugin.Events.Out), []string{pipelineName, plugin.ID, plugin.Name, index}},
+			pipelineMetricData{c.FilterDuration, float64(plugin.Events.DurationInMillis) / 1000.0, []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.FilterIn, float64(plugin.Events.In), []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.FilterOut, float64(plugin.Events.Out), []string{pipelineName, id, plugin.Name}},
 		)
+		if plugin.Matches != nil {
+			filterMetrics = append(filterMetrics, pipelineMetricData{c.FilterMatches, float64(*plugin.Matches), []string{pipelineName, id, plugin.Name}})
+		}
+		if plugin.Failures != nil {
+			filterMetrics = append(filterMetrics, pipelineMetricData{c.FilterFailures, float64(*plugin.Failures), []string{pipelineName, id, plugin.Name}})
+		}
+		if c.options.PluginMetrics {
+			pluginMetrics = c.appendPluginMetrics(pluginMetrics, pipelineName, "filter", id, plugin.Name, plugin.Metrics())
+		}
 	}
 
 	for _, plugin := range p.Plugins.Outputs {
+		id := ids.pluginID("output", plugin.ID, plugin.Name)
+		if !c.firstOccurrence(seen, pipelineName, "output", id) {
+			continue
+		}
 		outputMetrics = append(outputMetrics,
-			pipelineMetricData{c.OutputDuration, prometheus.CounterValue, float64(plugin.Events.DurationInMillis) / 1000.0, []string{pipelineName, plugin.ID, plugin.Name}},
-			pipelineMetricData{c.OutputIn, prometheus.CounterValue, float64(plugin.Events.In), []string{pipelineName, plugin.ID, plugin.Name}},
-			pipelineMetricData{c.OutputOut, prometheus.CounterValue, float64(plugin.Events.Out), []string{pipelineName, plugin.ID, plugin.Name}},
-			pipelineMetricData{c.OutputSuccesses, prometheus.CounterValue, float64(plugin.Documents.Successes), []string{pipelineName, plugin.ID, plugin.Name}},
-			pipelineMetricData{c.OutputNonRetryableFailures, prometheus.CounterValue, float64(plugin.Documents.NonRetryableFailures), []string{pipelineName, plugin.ID, plugin.Name}},
+			pipelineMetricData{c.OutputDuration, float64(plugin.Events.DurationInMillis) / 1000.0, []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.OutputIn, float64(plugin.Events.In), []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.OutputOut, float64(plugin.Events.Out), []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.OutputSuccesses, float64(plugin.Documents.Successes), []string{pipelineName, id, plugin.Name}},
+			pipelineMetricData{c.OutputNonRetryableFailures, float64(plugin.Documents.NonRetryableFailures), []string{pipelineName, id, plugin.Name}},
 		)
+		if c.options.PluginMetrics {
+			pluginMetrics = c.appendPluginMetrics(pluginMetrics, pipelineName, "output", id, plugin.Name, plugin.Metrics())
+		}
+	}
+
+	return append(append(append(inputMetrics, filterMetrics...), outputMetrics...), pluginMetrics...)
+}
+
+// firstOccurrence reports whether the plugin identified by pluginType and id is
+// seen for the first time in the pipeline, counting it as a duplicate otherwise.
+func (c *PipelinesCollector) firstOccurrence(seen map[string]struct{}, pipelineName, pluginType, id string) bool {
+	key := pluginType + "/" + id
+	if _, ok := seen[key]; ok {
+		c.DuplicatePlugins.WithLabelValues(pipelineName, pluginType).Inc()
+		return false
+	}
+
+	seen[key] = struct{}{}
+	return true
+}
+
+// appendPluginMetrics appends the plugin_metric series of pm in key order, so
+// that the MaxPluginSeries option keeps the same series every scrape.
+func (c *PipelinesCollector) appendPluginMetrics(metrics []pipelineMetricData, pipelineName, pluginType, id, name string, pm PluginMetrics) []pipelineMetricData {
+	keys := make([]string, 0, len(pm))
+	for key := range pm {
+		if c.pluginMetricKeyAllowed(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		metrics = append(metrics, pipelineMetricData{c.PluginMetric, pm[key], []string{pipelineName, pluginType, id, name, key}})
+	}
+
+	return metrics
+}
+
+func (c *PipelinesCollector) pluginMetricKeyAllowed(key string) bool {
+	if len(c.options.PluginMetricKeys) == 0 {
+		return true
 	}
 
-	for _, m := range append(append(append(append(append(eventMetrics, queueMetrics...), deadLetterQueueMetrics...), inputMetrics...), filterMetrics...), outputMetrics...) {
-		ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, m.value, m.labels...)
+	for _, allowed := range c.options.PluginMetricKeys {
+		if key == allowed {
+			return true
+		}
 	}
+
+	return false
 }
@@ -0,0 +1,26 @@
+package node_stats
+
+import "testing"
+
+func TestPluginIDs(t *testing.T) {
+	const generated = "0123456789abcdef0123456789abcdef"
+	ids := pluginIDs{replaceGenerated: true, occurrences: make(map[string]int)}
+	for _, test := range []struct {
+		pluginType, id, name, want string
+	}{
+		{"filter", generated, "mutate", "mutate_0"},
+		{"filter", "explicit", "mutate", "explicit"},
+		{"filter", generated + "1", "mutate", "mutate_1"},
+		{"filter", generated, "grok", "grok_0"},
+		{"output", generated, "mutate", "mutate_0"},
+	} {
+		if got := ids.pluginID(test.pluginType, test.id, test.name); got != test.want {
+			t.Errorf("%s %s %s: ID %q, want %q", test.pluginType, test.name, test.id, got, test.want)
+		}
+	}
+
+	ids = pluginIDs{occurrences: make(map[string]int)}
+	if got := ids.pluginID("filter", generated, "mutate"); got != generated {
+		t.Errorf("ID %q, want the generated ID kept", got)
+	}
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"prom-logstash-exporter/pkg/discovery"
+	"prom-logstash-exporter/pkg/helpers"
+	"sort"
+	"sync"
+)
+
+// Targets collects the Logstash instances found by target discovery, keeping
+// one Collector per target. Every metric of a target is labeled with its
+// discovery labels and its address as instance.
+type Targets struct {
+	options     Options
+	concurrency int
+
+	mutex      sync.Mutex
+	sources    map[string][]discovery.Target
+	collectors map[string]*Collector
+}
+
+// NewTargets returns an empty set of targets whose collectors are created with
+// options, the ConstLabels option being attached to the metrics of every target.
+// At most concurrency targets are scraped at once, without limit when it is 0.
+func NewTargets(options Options, concurrency int) (*Targets, error) {
+	if err := validateConstLabels(options); err != nil {
+		return nil, err
+	}
+
+	return &Targets{
+		options:     options,
+		concurrency: concurrency,
+		sources:     make(map[string][]discovery.Target),
+		collectors:  make(map[string]*Collector),
+	}, nil
+}
+
+// Sync replaces the targets discovered by source, creating the collectors of
+// the new targets and closing those of the targets no source reports anymore.
+func (t *Targets) Sync(source string, targets []discovery.Target) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.sources[source] = targets
+
+	wanted := make(map[string]discovery.Target)
+	for _, sourceTargets := range t.sources {
+		for _, target := range sourceTargets {
+			wanted[target.Key()] = target
+		}
+	}
+
+	for key, c := range t.collectors {
+		if _, ok := wanted[key]; !ok {
+			logrus.WithField("target", key).Infoln("Removing Logstash target")
+			c.Close()
+			delete(t.collectors, key)
+		}
+	}
+
+	for key, target := range wanted {
+		if _, ok := t.collectors[key]; ok {
+			continue
+		}
+
+		c, err := NewLogstashCollector(target.URL(), t.targetOptions(target))
+		if err != nil {
+			logrus.WithError(err).WithField("target", key).Errorln("Skipping Logstash target")
+			continue
+		}
+		logrus.WithField("target", key).Infoln("Adding Logstash target")
+		t.collectors[key] = c
+	}
+}
+
+// Close closes the collectors of every target.
+func (t *Targets) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, c := range t.collectors {
+		c.Close()
+	}
+}
+
+func (t *Targets) targetOptions(target discovery.Target) Options {
+	options := t.options
+	options.ConstLabels = helpers.MergeLabels(t.options.ConstLabels, target.Labels)
+	options.ConstLabels[discovery.InstanceLabel] = target.Address
+	return options
+}
+
+// Describe sends no descriptor: the targets change at runtime, so Targets is
+// registered as an unchecked collector.
+func (t *Targets) Describe(chan<- *prometheus.Desc) {}
+
+func (t *Targets) Collect(ch chan<- prometheus.Metric) {
+	t.collectAll(func(c *Collector) {
+		c.Collect(ch)
+	})
+}
+
+// Select returns a view of the targets running only the enabled collectors
+// whose name is in names, as requested with the collect[] query parameter.
+func (t *Targets) Select(names []string) (prometheus.Collector, error) {
+	collectors, err := t.options.enabledCollectors().Select(names)
+	if err != nil {
+		return nil, err
+	}
+	return &selectedTargets{targets: t, collectors: collectors}, nil
+}
+
+// collectAll calls collect with the collector of every target, scraping up to
+// the concurrency limit of targets at once. Each scrape is bounded by the
+// timeout of its target, so a slow target does not delay the others.
+func (t *Targets) collectAll(collect func(c *Collector)) {
+	collectors := t.snapshot()
+
+	concurrency := t.concurrency
+	if concurrency <= 0 || concurrency > len(collectors) {
+		concurrency = len(collectors)
+	}
+	semaphore := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, c := range collectors {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(c *Collector) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			collect(c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// snapshot returns the current collectors in target order.
+func (t *Targets) snapshot() []*Collector {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	keys := make([]string, 0, len(t.collectors))
+	for key := range t.collectors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	collectors := make([]*Collector, 0, len(keys))
+	for _, key := range keys {
+		collectors = append(collectors, t.collectors[key])
+	}
+	return collectors
+}
+
+type selectedTargets struct {
+	targets    *Targets
+	collectors Selection
+}
+
+func (s *selectedTargets) Describe(chan<- *prometheus.Desc) {}
+
+func (s *selectedTargets) Collect(ch chan<- prometheus.Metric) {
+	s.targets.collectAll(func(c *Collector) {
+		c.collect(s.collectors, ch)
+	})
+}
@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"prom-logstash-exporter/pkg/discovery"
+)
+
+// connTracker counts the open connections of a fake Logstash.
+type connTracker struct {
+	mutex sync.Mutex
+	open  int
+}
+
+func (c *connTracker) connState(_ net.Conn, state http.ConnState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch state {
+	case http.StateNew:
+		c.open++
+	case http.StateClosed, http.StateHijacked:
+		c.open--
+	}
+}
+
+func (c *connTracker) openConns() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.open
+}
+
+// newTrackedServer returns a fake Logstash serving the node_stats.json fixture
+// and tracking its connections.
+func newTrackedServer(t *testing.T) (*httptest.Server, *connTracker) {
+	data := readFixture(t, "node_stats.json")
+	tracker := &connTracker{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	server.Config.ConnState = tracker.connState
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, tracker
+}
+
+// waitConns waits for the connections open to a fake Logstash to be want.
+func waitConns(t *testing.T, tracker *connTracker, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for tracker.openConns() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections open, want %d", tracker.openConns(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTargetsSync(t *testing.T) {
+	serverA, trackerA := newTrackedServer(t)
+	serverB, trackerB := newTrackedServer(t)
+	targetA := discovery.Target{Address: serverA.Listener.Addr().String()}
+	targetB := discovery.Target{Address: serverB.Listener.Addr().String()}
+
+	targets, err := NewTargets(Options{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer targets.Close()
+
+	targets.Sync("file", []discovery.Target{targetA, targetB})
+	if n := testutil.CollectAndCount(targets, "logstash_up"); n != 2 {
+		t.Fatalf("collected %d logstash_up series, want 2", n)
+	}
+	waitConns(t, trackerA, 1)
+	waitConns(t, trackerB, 1)
+	collectorA := targets.collectors[targetA.Key()]
+
+	// targetB is removed: its collector is closed, dropping its idle connection,
+	// while the collector of targetA is kept along with its connection.
+	targets.Sync("file", []discovery.Target{targetA})
+	waitConns(t, trackerB, 0)
+	if got := len(targets.collectors); got != 1 {
+		t.Fatalf("%d collectors after the sync, want 1", got)
+	}
+	if targets.collectors[targetA.Key()] != collectorA {
+		t.Error("the collector of the unchanged target was replaced")
+	}
+	if n := trackerA.openConns(); n != 1 {
+		t.Errorf("%d connections open to the unchanged target, want 1", n)
+	}
+
+	// A target reported by another source is kept when one of them drops it.
+	targets.Sync("dns", []discovery.Target{targetA})
+	targets.Sync("file", nil)
+	if targets.collectors[targetA.Key()] != collectorA {
+		t.Error("the collector of a target still reported by a source was replaced")
+	}
+	targets.Sync("dns", nil)
+	if got := len(targets.collectors); got != 0 {
+		t.Errorf("%d collectors once no source reports the target, want 0", got)
+	}
+	waitConns(t, trackerA, 0)
+}
+
+func TestTargetsScrapeConcurrency(t *testing.T) {
+	const concurrency = 2
+	data := readFixture(t, "node_stats.json")
+	var mutex sync.Mutex
+	var inFlight, maxInFlight, scrapes int
+	var sources []discovery.Target
+	for i := 0; i < 6; i++ {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			inFlight++
+			scrapes++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mutex.Unlock()
+
+			time.Sleep(50 * time.Millisecond)
+			_, _ = w.Write(data)
+
+			mutex.Lock()
+			inFlight--
+			mutex.Unlock()
+		}))
+		t.Cleanup(server.Close)
+		sources = append(sources, discovery.Target{Address: server.Listener.Addr().String()})
+	}
+
+	targets, err := NewTargets(Options{}, concurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer targets.Close()
+	targets.Sync("file", sources)
+
+	if n := testutil.CollectAndCount(targets, "logstash_up"); n != len(sources) {
+		t.Fatalf("collected %d logstash_up series, want %d", n, len(sources))
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if scrapes != len(sources) {
+		t.Errorf("%d targets scraped, want %d", scrapes, len(sources))
+	}
+	if maxInFlight != concurrency {
+		t.Errorf("up to %d targets scraped at once, want %d", maxInFlight, concurrency)
+	}
+}
+
+func TestTargetsHungTarget(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(hung.Close)
+	data := readFixture(t, "node_stats.json")
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(timeout / 2)
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(slow.Close)
+	fast := newBodyServer(t, data)
+	sources := []discovery.Target{
+		{Address: hung.Listener.Addr().String()},
+		{Address: fast.Listener.Addr().String()},
+		{Address: slow.Listener.Addr().String()},
+	}
+
+	targets, err := NewTargets(Options{Client: ClientOptions{Timeout: timeout}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer targets.Close()
+	targets.Sync("file", sources)
+
+	// The hung target only holds one of the two scrape slots until its own
+	// timeout: the other targets are scraped meanwhile, or right after it when
+	// they hold both slots first.
+	start := time.Now()
+	up := gatherFamilies(t, targets)["logstash_up"]
+	if elapsed := time.Since(start); elapsed > 2*timeout {
+		t.Errorf("scrape took %v, want the hung target to time out after %v", elapsed, timeout)
+	}
+	for i, target := range sources {
+		want := 1.0
+		if i == 0 {
+			want = 0
+		}
+		if got := up["instance="+target.Address]; got != want {
+			t.Errorf("logstash_up of %s = %v, want %v", target.Address, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package discovery
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InstanceLabel is the label identifying the discovered target of a series.
+const InstanceLabel = "instance"
+
+// Target is a discovered Logstash instance.
+type Target struct {
+	// Address is the host:port or URL of the Logstash API.
+	Address string
+	// Labels are attached to every metric of the target.
+	Labels map[string]string
+}
+
+// URL returns the base URL of the Logstash API of the target, http being
+// assumed when Address has no scheme.
+func (t Target) URL() string {
+	if strings.Contains(t.Address, "://") {
+		return t.Address
+	}
+	return "http://" + t.Address
+}
+
+// Key identifies the target by its address and labels.
+func (t Target) Key() string {
+	names := make([]string, 0, len(t.Labels))
+	for name := range t.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(t.Address)
+	for _, name := range names {
+		b.WriteString("," + name + "=" + t.Labels[name])
+	}
+	return b.String()
+}
+
+// Discoverer lists the current targets of a discovery mechanism.
+type Discoverer interface {
+	Discover(ctx context.Context) ([]Target, error)
+}
+
+// Watcher is a Discoverer notified of the changes of its targets.
+type Watcher interface {
+	Discoverer
+	// Watch calls sync with the current targets and every time they change,
+	// until resync has elapsed, when the targets must be listed again, or ctx
+	// is done.
+	Watch(ctx context.Context, resync time.Duration, sync func([]Target)) error
+}
+
+// Run calls sync with the targets found by d now and every interval until ctx
+// is done. When d is a Watcher, sync is also called every time the targets
+// change, d listing them again every interval. When discovery fails, the error
+// is logged and the previously discovered targets are kept until the next
+// interval.
+func Run(ctx context.Context, name string, d Discoverer, interval time.Duration, sync func([]Target)) {
+	if w, ok := d.(Watcher); ok {
+		for ctx.Err() == nil {
+			if err := w.Watch(ctx, interval, sync); err != nil && ctx.Err() == nil {
+				logrus.WithError(err).WithField("discovery", name).Errorln("Target discovery failed")
+				select {
+				case <-ctx.Done():
+				case <-time.After(interval):
+				}
+			}
+		}
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		targets, err := d.Discover(ctx)
+		if err != nil {
+			logrus.WithError(err).WithField("discovery", name).Errorln("Target discovery failed")
+		} else {
+			sync(targets)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
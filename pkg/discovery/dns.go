@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DNS record types the DNSDiscoverer can query.
+const (
+	RecordSRV  = "SRV"
+	RecordA    = "A"
+	RecordAAAA = "AAAA"
+)
+
+// Resolver performs the DNS lookups of a DNSDiscoverer. It is implemented by
+// *net.Resolver, and can be replaced to discover targets offline.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// DNSDiscoverer finds targets by resolving DNS names, such as the name of a
+// headless service in front of the Logstash nodes. Names that do not exist,
+// like the name of a service scaled to zero, have no targets. When a name
+// cannot be resolved, the error is logged and the addresses it last resolved
+// to are kept, the targets of the other names being updated.
+type DNSDiscoverer struct {
+	// Names are the DNS names to resolve.
+	Names []string
+	// Type is the record type queried: SRV records give the host and port of
+	// each target, A and AAAA records their addresses, Port being used.
+	Type string
+	// Port is the port of the Logstash API of the A and AAAA targets.
+	Port int
+	// Resolver performs the lookups, net.DefaultResolver when nil.
+	Resolver Resolver
+
+	addresses map[string][]string
+}
+
+func (d *DNSDiscoverer) Discover(ctx context.Context) ([]Target, error) {
+	switch d.Type {
+	case RecordSRV, RecordA, RecordAAAA:
+	default:
+		return nil, fmt.Errorf("unsupported DNS record type %q, must be one of %s, %s, %s", d.Type, RecordSRV, RecordA, RecordAAAA)
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if d.Resolver != nil {
+		resolver = d.Resolver
+	}
+
+	addresses := make(map[string][]string, len(d.Names))
+	var targets []Target
+	for _, name := range d.Names {
+		if _, seen := addresses[name]; seen {
+			continue
+		}
+
+		resolved, err := d.resolve(ctx, resolver, name)
+		var dnsErr *net.DNSError
+		switch {
+		case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+			resolved = nil
+		case err != nil:
+			logrus.WithError(err).WithFields(logrus.Fields{"discovery": "dns", "name": name}).Warnln("Keeping the previous targets of the DNS name")
+			resolved = d.addresses[name]
+		}
+
+		addresses[name] = resolved
+		for _, address := range resolved {
+			targets = append(targets, Target{Address: address})
+		}
+	}
+
+	d.addresses = addresses
+	return targets, nil
+}
+
+// resolve returns the host:port addresses name resolves to.
+func (d *DNSDiscoverer) resolve(ctx context.Context, resolver Resolver, name string) ([]string, error) {
+	switch d.Type {
+	case RecordSRV:
+		_, records, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve SRV records of %s: %w", name, err)
+		}
+
+		addresses := make([]string, 0, len(records))
+		for _, record := range records {
+			addresses = append(addresses, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+		}
+		return addresses, nil
+	default:
+		ips, err := resolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s records of %s: %w", d.Type, name, err)
+		}
+
+		var addresses []string
+		for _, ip := range ips {
+			if (ip.IP.To4() != nil) != (d.Type == RecordA) {
+				continue
+			}
+			addresses = append(addresses, net.JoinHostPort(ip.IP.String(), strconv.Itoa(d.Port)))
+		}
+		return addresses, nil
+	}
+}
@@ -0,0 +1,159 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// fakeResolver answers the lookups of a name with its records, or with its
+// error when it has one.
+type fakeResolver struct {
+	srv    map[string][]*net.SRV
+	ips    map[string][]net.IPAddr
+	errors map[string]error
+}
+
+func (r *fakeResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	if err := r.errors[name]; err != nil {
+		return "", nil, err
+	}
+	return name, r.srv[name], nil
+}
+
+func (r *fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if err := r.errors[host]; err != nil {
+		return nil, err
+	}
+	return r.ips[host], nil
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func addresses(targets []Target) []string {
+	var addresses []string
+	for _, target := range targets {
+		addresses = append(addresses, target.Address)
+	}
+	return addresses
+}
+
+func TestDNSDiscovererSRV(t *testing.T) {
+	d := &DNSDiscoverer{
+		Names: []string{"_http._tcp.logstash.svc"},
+		Type:  RecordSRV,
+		Resolver: &fakeResolver{srv: map[string][]*net.SRV{
+			"_http._tcp.logstash.svc": {
+				{Target: "logstash-0.logstash.svc.", Port: 9600},
+				{Target: "logstash-1.logstash.svc.", Port: 9601},
+			},
+		}},
+	}
+
+	targets, err := d.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"logstash-0.logstash.svc:9600", "logstash-1.logstash.svc:9601"}
+	if got := addresses(targets); !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+}
+
+func TestDNSDiscovererRecordTypes(t *testing.T) {
+	resolver := &fakeResolver{ips: map[string][]net.IPAddr{
+		"logstash": {{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("fd00::1")}},
+	}}
+
+	for recordType, want := range map[string][]string{
+		RecordA:    {"10.0.0.1:9600"},
+		RecordAAAA: {"[fd00::1]:9600"},
+	} {
+		d := &DNSDiscoverer{Names: []string{"logstash"}, Type: recordType, Port: 9600, Resolver: resolver}
+		targets, err := d.Discover(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := addresses(targets); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s targets = %v, want %v", recordType, got, want)
+		}
+	}
+
+	d := &DNSDiscoverer{Names: []string{"logstash"}, Type: "MX", Resolver: resolver}
+	if _, err := d.Discover(context.Background()); err == nil {
+		t.Error("MX records were queried, want an unsupported record type error")
+	}
+}
+
+func TestDNSDiscovererNotFound(t *testing.T) {
+	resolver := &fakeResolver{
+		ips: map[string][]net.IPAddr{
+			"logstash-a": {{IP: net.ParseIP("10.0.0.1")}},
+			"logstash-b": {{IP: net.ParseIP("10.0.0.2")}},
+		},
+		errors: map[string]error{},
+	}
+	d := &DNSDiscoverer{Names: []string{"logstash-a", "logstash-b"}, Type: RecordA, Port: 9600, Resolver: resolver}
+	if _, err := d.Discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// logstash-b is scaled to zero: its targets are removed, the other name still resolves.
+	resolver.errors["logstash-b"] = notFound("logstash-b")
+	targets, err := d.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := addresses(targets), []string{"10.0.0.1:9600"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+
+	resolver.errors["logstash-a"] = notFound("logstash-a")
+	targets, err = d.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 0 {
+		t.Errorf("targets = %v, want none", addresses(targets))
+	}
+}
+
+func TestDNSDiscovererErrorPerName(t *testing.T) {
+	resolver := &fakeResolver{
+		ips: map[string][]net.IPAddr{
+			"logstash-a": {{IP: net.ParseIP("10.0.0.1")}},
+			"logstash-b": {{IP: net.ParseIP("10.0.0.2")}},
+		},
+		errors: map[string]error{},
+	}
+	d := &DNSDiscoverer{Names: []string{"logstash-a", "logstash-b"}, Type: RecordA, Port: 9600, Resolver: resolver}
+	if _, err := d.Discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lookup of logstash-a fails: it keeps its targets while logstash-b is updated.
+	resolver.errors["logstash-a"] = &net.DNSError{Err: "server misbehaving", Name: "logstash-a", IsTemporary: true}
+	resolver.ips["logstash-b"] = []net.IPAddr{{IP: net.ParseIP("10.0.0.3")}}
+	targets, err := d.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := addresses(targets), []string{"10.0.0.1:9600", "10.0.0.3:9600"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+
+	// A name failing before it was ever resolved has no targets.
+	d = &DNSDiscoverer{Names: []string{"logstash-a", "logstash-b"}, Type: RecordA, Port: 9600, Resolver: resolver}
+	resolver.errors["logstash-a"] = errors.New("connection refused")
+	targets, err = d.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := addresses(targets), []string{"10.0.0.3:9600"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+}
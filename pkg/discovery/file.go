@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// FileDiscoverer reads targets from files in the Prometheus file_sd format:
+// a JSON or YAML list of groups of targets sharing labels. Files are only
+// parsed again once their modification time changes.
+type FileDiscoverer struct {
+	// Patterns are the paths of the target files, as filepath.Glob patterns.
+	Patterns []string
+
+	files map[string]fileTargets
+}
+
+type fileTargets struct {
+	modTime time.Time
+	targets []Target
+}
+
+type targetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+func (d *FileDiscoverer) Discover(_ context.Context) ([]Target, error) {
+	files := make(map[string]fileTargets)
+	var targets []Target
+
+	for _, pattern := range d.Patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target file pattern %q: %w", pattern, err)
+		}
+
+		for _, path := range paths {
+			if _, seen := files[path]; seen {
+				continue
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+
+			cached, ok := d.files[path]
+			if !ok || !cached.modTime.Equal(info.ModTime()) {
+				parsed, err := readTargetFile(path)
+				if err != nil {
+					return nil, err
+				}
+				cached = fileTargets{modTime: info.ModTime(), targets: parsed}
+			}
+
+			files[path] = cached
+			targets = append(targets, cached.targets...)
+		}
+	}
+
+	d.files = files
+	return targets, nil
+}
+
+func readTargetFile(path string) ([]Target, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []targetGroup
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &groups)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &groups)
+	default:
+		return nil, fmt.Errorf("target file %s must have a .json, .yml or .yaml extension", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target file %s: %w", path, err)
+	}
+
+	var targets []Target
+	for _, group := range groups {
+		labels := make(map[string]string, len(group.Labels))
+		for name, value := range group.Labels {
+			if strings.HasPrefix(name, model.ReservedLabelPrefix) {
+				continue
+			}
+			if !model.LabelName(name).IsValid() {
+				return nil, fmt.Errorf("invalid label name %q in target file %s", name, path)
+			}
+			labels[name] = value
+		}
+
+		for _, address := range group.Targets {
+			targets = append(targets, Target{Address: address, Labels: labels})
+		}
+	}
+	return targets, nil
+}
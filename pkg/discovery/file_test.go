@@ -0,0 +1,132 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeTargetFile writes content to path and sets its modification time.
+func writeTargetFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileDiscovererRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yml")
+	modTime := time.Now().Add(-time.Hour)
+	writeTargetFile(t, path, `
+- targets: [logstash-a:9600, logstash-b:9600]
+  labels: {env: prod}
+`, modTime)
+
+	d := &FileDiscoverer{Patterns: []string{filepath.Join(filepath.Dir(path), "*.yml")}}
+	targets, err := d.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := addresses(targets), []string{"logstash-a:9600", "logstash-b:9600"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("targets = %v, want %v", got, want)
+	}
+	if got, want := targets[0].Labels, map[string]string{"env": "prod"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("labels = %v, want %v", got, want)
+	}
+
+	// logstash-a is removed and logstash-c added.
+	writeTargetFile(t, path, `
+- targets: [logstash-b:9600, logstash-c:9600]
+  labels: {env: prod}
+`, modTime.Add(time.Minute))
+	targets, err = d.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := addresses(targets), []string{"logstash-b:9600", "logstash-c:9600"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets after the rewrite = %v, want %v", got, want)
+	}
+
+	// A removed file no longer has targets.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	targets, err = d.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 0 {
+		t.Errorf("targets after the removal = %v, want none", addresses(targets))
+	}
+}
+
+func TestFileDiscovererUnchangedModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	modTime := time.Now().Add(-time.Hour)
+	writeTargetFile(t, path, `[{"targets": ["logstash-a:9600"]}]`, modTime)
+
+	d := &FileDiscoverer{Patterns: []string{path}}
+	if _, err := d.Discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is not parsed again while its modification time is unchanged,
+	// even though its content is no longer valid.
+	writeTargetFile(t, path, `not json`, modTime)
+	targets, err := d.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("file with an unchanged modification time parsed again: %v", err)
+	}
+	if got, want := addresses(targets), []string{"logstash-a:9600"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+}
+
+func TestFileDiscovererParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	modTime := time.Now().Add(-time.Hour)
+	writeTargetFile(t, path, `[{"targets": ["logstash-a:9600"]}]`, modTime)
+
+	d := &FileDiscoverer{Patterns: []string{path}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	discovered := make(chan []Target)
+	go Run(ctx, "file", d, 20*time.Millisecond, func(targets []Target) {
+		select {
+		case discovered <- targets:
+		case <-ctx.Done():
+		}
+	})
+
+	if got, want := nextTargets(t, discovered), []string{"logstash-a:9600"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("targets = %v, want %v", got, want)
+	}
+
+	// While the file can't be parsed, the targets are not replaced.
+	writeTargetFile(t, path, `[{"targets": ["logstash-b:9600"]`, modTime.Add(time.Minute))
+	if _, err := (&FileDiscoverer{Patterns: []string{path}}).Discover(context.Background()); err == nil {
+		t.Error("truncated target file parsed, want an error")
+	}
+	drain := time.After(100 * time.Millisecond)
+	for draining := true; draining; {
+		select {
+		case targets := <-discovered:
+			if got, want := addresses(targets), []string{"logstash-a:9600"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("targets synced from a truncated file = %v, want %v", got, want)
+			}
+		case <-drain:
+			draining = false
+		}
+	}
+
+	writeTargetFile(t, path, `[{"targets": ["logstash-b:9600"]}]`, modTime.Add(2*time.Minute))
+	if got, want := nextTargets(t, discovered), []string{"logstash-b:9600"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets once the file is fixed = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,338 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels attached to the targets discovered in Kubernetes.
+const (
+	NamespaceLabel = "namespace"
+	PodLabel       = "pod"
+	NodeLabel      = "node"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Pod holds the fields of a Kubernetes pod the discovery reads.
+type Pod struct {
+	Metadata struct {
+		Name              string  `json:"name"`
+		Namespace         string  `json:"namespace"`
+		ResourceVersion   string  `json:"resourceVersion"`
+		DeletionTimestamp *string `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName   string `json:"nodeName"`
+		Containers []struct {
+			Ports []struct {
+				Name          string `json:"name"`
+				ContainerPort int    `json:"containerPort"`
+			} `json:"ports"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+		PodIP string `json:"podIP"`
+	} `json:"status"`
+}
+
+type podList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []Pod `json:"items"`
+}
+
+// Types of the events of a pod watch.
+const (
+	PodAdded    = "ADDED"
+	PodModified = "MODIFIED"
+	PodDeleted  = "DELETED"
+	PodBookmark = "BOOKMARK"
+)
+
+// PodEvent is a change of a watched pod. Bookmark events only carry the
+// resource version of the pod list.
+type PodEvent struct {
+	Type string
+	Pod  Pod
+}
+
+// ErrWatchExpired is returned by PodLister.WatchPods when the resource version
+// the watch started from is too old: the pods must be listed again.
+var ErrWatchExpired = errors.New("pod watch expired")
+
+// PodLister lists and watches the pods of namespace, all namespaces when
+// empty, matching a Kubernetes label selector.
+type PodLister interface {
+	// ListPods returns the pods and the resource version of the list.
+	ListPods(ctx context.Context, namespace, labelSelector string) ([]Pod, string, error)
+	// WatchPods calls event with the changes of the pods after resourceVersion
+	// until the watch is closed by the server, returning nil, or fails.
+	WatchPods(ctx context.Context, namespace, labelSelector, resourceVersion string, event func(PodEvent)) error
+}
+
+// KubernetesDiscoverer finds the running Logstash pods matching a label
+// selector, scraping each on the container port named PortName of its pod IP.
+// Run watches the pods, listing them again every interval.
+type KubernetesDiscoverer struct {
+	Lister        PodLister
+	Namespace     string
+	LabelSelector string
+	PortName      string
+}
+
+func (d *KubernetesDiscoverer) Discover(ctx context.Context) ([]Target, error) {
+	pods, _, err := d.Lister.ListPods(ctx, d.Namespace, d.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	return d.targets(pods), nil
+}
+
+// Watch lists the pods, then calls sync with the targets every time a pod
+// changes until resync has elapsed or ctx is done.
+func (d *KubernetesDiscoverer) Watch(ctx context.Context, resync time.Duration, sync func([]Target)) error {
+	pods, resourceVersion, err := d.Lister.ListPods(ctx, d.Namespace, d.LabelSelector)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]Pod, len(pods))
+	for _, pod := range pods {
+		current[podKey(pod)] = pod
+	}
+	sync(d.targets(pods))
+
+	ctx, cancel := context.WithTimeout(ctx, resync)
+	defer cancel()
+	for ctx.Err() == nil {
+		err := d.Lister.WatchPods(ctx, d.Namespace, d.LabelSelector, resourceVersion, func(event PodEvent) {
+			resourceVersion = event.Pod.Metadata.ResourceVersion
+			switch event.Type {
+			case PodAdded, PodModified:
+				current[podKey(event.Pod)] = event.Pod
+			case PodDeleted:
+				delete(current, podKey(event.Pod))
+			default:
+				return
+			}
+
+			keys := make([]string, 0, len(current))
+			for key := range current {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			pods := make([]Pod, 0, len(keys))
+			for _, key := range keys {
+				pods = append(pods, current[key])
+			}
+			sync(d.targets(pods))
+		})
+		if errors.Is(err, ErrWatchExpired) || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func podKey(pod Pod) string {
+	return pod.Metadata.Namespace + "/" + pod.Metadata.Name
+}
+
+// targets returns the targets of the running pods exposing the PortName port.
+func (d *KubernetesDiscoverer) targets(pods []Pod) []Target {
+	var targets []Target
+	for _, pod := range pods {
+		if pod.Status.Phase != "Running" || pod.Status.PodIP == "" || pod.Metadata.DeletionTimestamp != nil {
+			continue
+		}
+
+		port, ok := d.podPort(pod)
+		if !ok {
+			continue
+		}
+
+		targets = append(targets, Target{
+			Address: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)),
+			Labels: map[string]string{
+				NamespaceLabel: pod.Metadata.Namespace,
+				PodLabel:       pod.Metadata.Name,
+				NodeLabel:      pod.Spec.NodeName,
+			},
+		})
+	}
+	return targets
+}
+
+func (d *KubernetesDiscoverer) podPort(pod Pod) (int, bool) {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == d.PortName {
+				return port.ContainerPort, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// APIPodLister lists pods with the Kubernetes REST API.
+type APIPodLister struct {
+	// Server is the base URL of the API server.
+	Server string
+	// TokenFile holds the bearer token of the requests, read on every request
+	// as service account tokens are rotated. No token is sent when empty.
+	TokenFile string
+	// Client performs the requests, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// NewInClusterPodLister returns an APIPodLister authenticated with the service
+// account of the pod the exporter runs in.
+func NewInClusterPodLister() (*APIPodLister, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in %s/ca.crt", serviceAccountDir)
+	}
+
+	return &APIPodLister{
+		Server:    "https://" + net.JoinHostPort(host, port),
+		TokenFile: serviceAccountDir + "/token",
+		Client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+func (l *APIPodLister) ListPods(ctx context.Context, namespace, labelSelector string) ([]Pod, string, error) {
+	response, err := l.get(ctx, namespace, url.Values{"labelSelector": {labelSelector}})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list pods: %w", err)
+	}
+	defer response.Body.Close()
+
+	var pods podList
+	if err := json.NewDecoder(response.Body).Decode(&pods); err != nil {
+		return nil, "", fmt.Errorf("failed to decode pod list: %w", err)
+	}
+	return pods.Items, pods.Metadata.ResourceVersion, nil
+}
+
+func (l *APIPodLister) WatchPods(ctx context.Context, namespace, labelSelector, resourceVersion string, event func(PodEvent)) error {
+	response, err := l.get(ctx, namespace, url.Values{
+		"labelSelector":       {labelSelector},
+		"watch":               {"1"},
+		"resourceVersion":     {resourceVersion},
+		"allowWatchBookmarks": {"true"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch pods: %w", err)
+	}
+	defer response.Body.Close()
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var watchEvent struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&watchEvent); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode pod watch event: %w", err)
+		}
+
+		if watchEvent.Type == "ERROR" {
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(watchEvent.Object, &status); err != nil {
+				return fmt.Errorf("failed to decode pod watch error: %w", err)
+			}
+			if status.Code == http.StatusGone {
+				return ErrWatchExpired
+			}
+			return fmt.Errorf("pod watch failed: %s", status.Message)
+		}
+
+		var pod Pod
+		if err := json.Unmarshal(watchEvent.Object, &pod); err != nil {
+			return fmt.Errorf("failed to decode pod watch event: %w", err)
+		}
+		event(PodEvent{Type: watchEvent.Type, Pod: pod})
+	}
+}
+
+// get requests the pods of namespace with query, empty parameters being left out.
+func (l *APIPodLister) get(ctx context.Context, namespace string, query url.Values) (*http.Response, error) {
+	path := "/api/v1/pods"
+	if namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods"
+	}
+	for name, values := range query {
+		if len(values) == 0 || values[0] == "" {
+			delete(query, name)
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(l.Server, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if l.TokenFile != "" {
+		token, err := os.ReadFile(l.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusGone {
+		response.Body.Close()
+		return nil, ErrWatchExpired
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+	return response, nil
+}
@@ -0,0 +1,299 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPIServer serves the pods of the logstash namespace, filtered by the
+// label selector of the requests like the Kubernetes API server does. Watches
+// receive the pods changed through add and remove.
+type fakeAPIServer struct {
+	*httptest.Server
+
+	mutex           sync.Mutex
+	pods            map[string]fakePod
+	resourceVersion int
+	watches         []chan fakeEvent
+}
+
+type fakePod struct {
+	name, ip string
+	labels   map[string]string
+}
+
+type fakeEvent struct {
+	eventType string
+	pod       fakePod
+}
+
+func newFakeAPIServer(t *testing.T) *fakeAPIServer {
+	s := &fakeAPIServer{pods: make(map[string]fakePod)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.servePods))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeAPIServer) add(pod fakePod) {
+	s.notify(fakeEvent{PodAdded, pod})
+}
+
+func (s *fakeAPIServer) remove(name string) {
+	s.mutex.Lock()
+	pod := s.pods[name]
+	s.mutex.Unlock()
+	s.notify(fakeEvent{PodDeleted, pod})
+}
+
+func (s *fakeAPIServer) notify(event fakeEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.resourceVersion++
+	if event.eventType == PodDeleted {
+		delete(s.pods, event.pod.name)
+	} else {
+		s.pods[event.pod.name] = event.pod
+	}
+	for _, watch := range s.watches {
+		watch <- event
+	}
+}
+
+// object returns the pod as served by the API, a running Logstash pod.
+func (s *fakeAPIServer) object(pod fakePod) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":            pod.name,
+			"namespace":       "logstash",
+			"labels":          pod.labels,
+			"resourceVersion": strconv.Itoa(s.resourceVersion),
+		},
+		"spec": map[string]interface{}{
+			"nodeName": "node-1",
+			"containers": []interface{}{map[string]interface{}{
+				"ports": []interface{}{map[string]interface{}{"name": "monitoring", "containerPort": 9600}},
+			}},
+		},
+		"status": map[string]interface{}{"phase": "Running", "podIP": pod.ip},
+	}
+}
+
+// matches evaluates an equality-based label selector.
+func matches(labels map[string]string, selector string) bool {
+	for _, requirement := range strings.Split(selector, ",") {
+		if requirement == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(requirement, "=")
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *fakeAPIServer) servePods(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/namespaces/logstash/pods" {
+		http.NotFound(w, r)
+		return
+	}
+	selector := r.URL.Query().Get("labelSelector")
+
+	s.mutex.Lock()
+	if r.URL.Query().Get("watch") == "" {
+		names := make([]string, 0, len(s.pods))
+		for name := range s.pods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		items := []interface{}{}
+		for _, name := range names {
+			if matches(s.pods[name].labels, selector) {
+				items = append(items, s.object(s.pods[name]))
+			}
+		}
+		list := map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": strconv.Itoa(s.resourceVersion)},
+			"items":    items,
+		}
+		s.mutex.Unlock()
+		_ = json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	if r.URL.Query().Get("resourceVersion") != strconv.Itoa(s.resourceVersion) {
+		s.mutex.Unlock()
+		http.Error(w, "unexpected resource version", http.StatusGone)
+		return
+	}
+	events := make(chan fakeEvent, 16)
+	s.watches = append(s.watches, events)
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for i, watch := range s.watches {
+			if watch == events {
+				s.watches = append(s.watches[:i], s.watches[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if !matches(event.pod.labels, selector) {
+				continue
+			}
+			s.mutex.Lock()
+			object := s.object(event.pod)
+			s.mutex.Unlock()
+			_ = encoder.Encode(map[string]interface{}{"type": event.eventType, "object": object})
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+// nextTargets returns the addresses of the next targets discovered.
+func nextTargets(t *testing.T, discovered <-chan []Target) []string {
+	t.Helper()
+	select {
+	case targets := <-discovered:
+		addresses := []string{}
+		for _, target := range targets {
+			addresses = append(addresses, target.Address)
+		}
+		return addresses
+	case <-time.After(5 * time.Second):
+		t.Fatal("no targets discovered")
+		return nil
+	}
+}
+
+func TestKubernetesDiscovererWatch(t *testing.T) {
+	server := newFakeAPIServer(t)
+	logstash := map[string]string{"app": "logstash"}
+	server.add(fakePod{"logstash-0", "10.0.0.1", logstash})
+	server.add(fakePod{"kibana-0", "10.0.0.9", map[string]string{"app": "kibana"}})
+
+	d := &KubernetesDiscoverer{
+		Lister:        &APIPodLister{Server: server.URL},
+		Namespace:     "logstash",
+		LabelSelector: "app=logstash",
+		PortName:      "monitoring",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	discovered := make(chan []Target)
+	go Run(ctx, "kubernetes", d, time.Hour, func(targets []Target) {
+		select {
+		case discovered <- targets:
+		case <-ctx.Done():
+		}
+	})
+
+	if got, want := nextTargets(t, discovered), []string{"10.0.0.1:9600"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("listed targets = %v, want %v", got, want)
+	}
+
+	// The watch is started once the pods are listed: wait for it before changing pods.
+	for i := 0; ; i++ {
+		server.mutex.Lock()
+		watching := len(server.watches) > 0
+		server.mutex.Unlock()
+		if watching {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the pods are not watched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Pods not matching the selector are filtered out of the watch.
+	server.add(fakePod{"kibana-1", "10.0.0.10", map[string]string{"app": "kibana"}})
+	server.add(fakePod{"logstash-1", "10.0.0.2", logstash})
+	if got, want := nextTargets(t, discovered), []string{"10.0.0.1:9600", "10.0.0.2:9600"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("targets after adding logstash-1 = %v, want %v", got, want)
+	}
+
+	server.remove("logstash-0")
+	if got, want := nextTargets(t, discovered), []string{"10.0.0.2:9600"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("targets after deleting logstash-0 = %v, want %v", got, want)
+	}
+}
+
+func TestKubernetesDiscovererResync(t *testing.T) {
+	server := newFakeAPIServer(t)
+	server.add(fakePod{"logstash-0", "10.0.0.1", map[string]string{"app": "logstash"}})
+
+	var lists int
+	var mutex sync.Mutex
+	lister := &APIPodLister{Server: server.URL}
+	d := &KubernetesDiscoverer{
+		Lister:        countingLister{lister, func() { mutex.Lock(); lists++; mutex.Unlock() }},
+		Namespace:     "logstash",
+		LabelSelector: "app=logstash",
+		PortName:      "monitoring",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	discovered := make(chan []Target)
+	go Run(ctx, "kubernetes", d, 50*time.Millisecond, func(targets []Target) {
+		select {
+		case discovered <- targets:
+		case <-ctx.Done():
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		if got, want := nextTargets(t, discovered), []string{"10.0.0.1:9600"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("resync %d targets = %v, want %v", i, got, want)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if lists < 3 {
+		t.Errorf("pods listed %d times, want one list per resync", lists)
+	}
+}
+
+// countingLister calls listed on every list of the pods.
+type countingLister struct {
+	PodLister
+	listed func()
+}
+
+func (l countingLister) ListPods(ctx context.Context, namespace, labelSelector string) ([]Pod, string, error) {
+	l.listed()
+	return l.PodLister.ListPods(ctx, namespace, labelSelector)
+}
+
+func TestAPIPodListerWatchExpired(t *testing.T) {
+	server := newFakeAPIServer(t)
+	lister := &APIPodLister{Server: server.URL}
+	err := lister.WatchPods(context.Background(), "logstash", "", "stale", func(PodEvent) {})
+	if !errors.Is(err, ErrWatchExpired) {
+		t.Errorf("watch from a stale resource version: %v, want %v", err, ErrWatchExpired)
+	}
+	if _, _, err := lister.ListPods(context.Background(), "default", ""); err == nil {
+		t.Error("listing the pods of another namespace succeeded, want a not found error")
+	}
+}
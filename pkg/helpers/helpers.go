@@ -1,7 +1,11 @@
 package helpers
 
 import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"net/url"
+	"regexp"
 	"strings"
 )
 
@@ -19,3 +23,46 @@ func ParseURI(uri string) (*url.URL, error) {
 
 	return parsedURL, nil
 }
+
+// CompileAnchoredRegexps compiles patterns into a single regexp matching a whole
+// string against any of them. It returns nil when patterns is empty.
+func CompileAnchoredRegexps(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	return regexp.Compile("^(?:" + strings.Join(patterns, "|") + ")$")
+}
+
+// ParseLabels parses name=value pairs into labels, rejecting invalid or reserved
+// label names and names given twice.
+func ParseLabels(pairs []string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %q is not of the form name=value", pair)
+		}
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if _, exists := labels[name]; exists {
+			return nil, fmt.Errorf("label %q given twice", name)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// MergeLabels returns the union of global and target labels, target labels
+// taking precedence.
+func MergeLabels(global, target prometheus.Labels) prometheus.Labels {
+	labels := make(prometheus.Labels, len(global)+len(target))
+	for name, value := range global {
+		labels[name] = value
+	}
+	for name, value := range target {
+		labels[name] = value
+	}
+	return labels
+}
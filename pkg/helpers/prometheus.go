@@ -4,8 +4,80 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func NewDescFQ(namespace, subsystem string) func(name, help string, labels ...string) *prometheus.Desc {
+// legacyMetricNames maps the metric names renamed to follow the Prometheus naming
+// conventions to the name they had before. They are used when Naming.Legacy is set.
+var legacyMetricNames = map[string]string{
+	"logstash_exporter_scrapes_total":             "logstash_exporter_total_scrapes",
+	"logstash_exporter_json_parse_failures_total": "logstash_exporter_json_parse_failures",
+	"logstash_jvm_threads":                        "logstash_jvm_threads_count",
+	"logstash_pipeline_queue_events":              "logstash_pipeline_queue_event_count",
+	"logstash_process_cpu_seconds_total":          "logstash_process_process_time_seconds",
+}
+
+// Naming builds the names of the metrics.
+type Naming struct {
+	// Legacy names the metrics renamed to follow the Prometheus naming
+	// conventions with the name they had before.
+	Legacy bool
+}
+
+// LegacyName returns the name fqName had before it was renamed, fqName when it was not renamed.
+func LegacyName(fqName string) string {
+	if legacyName, ok := legacyMetricNames[fqName]; ok {
+		return legacyName
+	}
+	return fqName
+}
+
+// LegacyNames returns the legacy name of every renamed metric, keyed by its current name.
+func LegacyNames() map[string]string {
+	names := make(map[string]string, len(legacyMetricNames))
+	for name, legacyName := range legacyMetricNames {
+		names[name] = legacyName
+	}
+	return names
+}
+
+// BuildFQName joins namespace, subsystem and name like prometheus.BuildFQName,
+// returning the legacy name of the metric when legacy names are enabled.
+func (n Naming) BuildFQName(namespace, subsystem, name string) string {
+	fqName := prometheus.BuildFQName(namespace, subsystem, name)
+	if n.Legacy {
+		return LegacyName(fqName)
+	}
+	return fqName
+}
+
+// NewDescFQ returns a constructor of descriptors sharing namespace, subsystem and
+// the constLabels attached to every series of the target.
+func (n Naming) NewDescFQ(namespace, subsystem string, constLabels prometheus.Labels) func(name, help string, labels ...string) *prometheus.Desc {
 	return func(name, help string, labels ...string) *prometheus.Desc {
-		return prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, labels, nil)
+		return prometheus.NewDesc(n.BuildFQName(namespace, subsystem, name), help, labels, constLabels)
+	}
+}
+
+// MetricDef describes a metric family once: its descriptor and the value type
+// every sample of the family is emitted with.
+type MetricDef struct {
+	Desc      *prometheus.Desc
+	ValueType prometheus.ValueType
+}
+
+// NewMetric builds a constant metric of the family.
+func (d MetricDef) NewMetric(value float64, labels ...string) (prometheus.Metric, error) {
+	return prometheus.NewConstMetric(d.Desc, d.ValueType, value, labels...)
+}
+
+// DescribeMetricDefs sends the descriptor of every def to ch.
+func DescribeMetricDefs(ch chan<- *prometheus.Desc, defs ...MetricDef) {
+	for _, def := range defs {
+		ch <- def.Desc
+	}
+}
+
+func (n Naming) NewMetricDefFQ(namespace, subsystem string, constLabels prometheus.Labels) func(name string, valueType prometheus.ValueType, help string, labels ...string) MetricDef {
+	desc := n.NewDescFQ(namespace, subsystem, constLabels)
+	return func(name string, valueType prometheus.ValueType, help string, labels ...string) MetricDef {
+		return MetricDef{Desc: desc(name, help, labels...), ValueType: valueType}
 	}
 }
@@ -0,0 +1,118 @@
+package relabel
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+type Action string
+
+const (
+	Replace   Action = "replace"
+	Keep      Action = "keep"
+	Drop      Action = "drop"
+	HashMod   Action = "hashmod"
+	LabelMap  Action = "labelmap"
+	LabelDrop Action = "labeldrop"
+	LabelKeep Action = "labelkeep"
+)
+
+// Config is a relabeling rule, with the fields and defaults of the Prometheus
+// metric_relabel_configs entries.
+type Config struct {
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    string   `yaml:"separator"`
+	Regex        Regexp   `yaml:"regex"`
+	Modulus      uint64   `yaml:"modulus"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  string   `yaml:"replacement"`
+	Action       Action   `yaml:"action"`
+}
+
+// File is the relabeling configuration file.
+type File struct {
+	MetricRelabelConfigs []*Config `yaml:"metric_relabel_configs"`
+}
+
+// Regexp is a regular expression anchored at both ends, like in Prometheus.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// NewRegexp compiles expr anchored at both ends.
+func NewRegexp(expr string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	return Regexp{re}, err
+}
+
+func (re *Regexp) UnmarshalYAML(value *yaml.Node) error {
+	var expr string
+	if err := value.Decode(&expr); err != nil {
+		return err
+	}
+
+	compiled, err := NewRegexp(expr)
+	if err != nil {
+		return err
+	}
+	*re = compiled
+	return nil
+}
+
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	type plain Config
+	config := plain{
+		Separator:   ";",
+		Regex:       Regexp{regexp.MustCompile("^(?:(.*))$")},
+		Replacement: "$1",
+		Action:      Replace,
+	}
+	if err := value.Decode(&config); err != nil {
+		return err
+	}
+	*c = Config(config)
+	return c.validate()
+}
+
+func (c *Config) validate() error {
+	switch c.Action {
+	case Replace, HashMod:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %q requires a target_label", c.Action)
+		}
+		if c.Action == Replace && !model.LabelName(c.TargetLabel).IsValid() && !hasReference(c.TargetLabel) {
+			return fmt.Errorf("invalid target_label %q", c.TargetLabel)
+		}
+		if c.Action == HashMod && c.Modulus == 0 {
+			return fmt.Errorf("relabel action %q requires a non-zero modulus", c.Action)
+		}
+	case Keep, Drop, LabelMap, LabelDrop, LabelKeep:
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	return nil
+}
+
+var referencePattern = regexp.MustCompile(`\$(?:\{\w+\}|\w+)`)
+
+func hasReference(s string) bool {
+	return referencePattern.MatchString(s)
+}
+
+// LoadFile reads the metric_relabel_configs of the YAML file at path.
+func LoadFile(path string) ([]*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return file.MetricRelabelConfigs, nil
+}
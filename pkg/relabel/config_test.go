@@ -0,0 +1,33 @@
+package relabel_test
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	"prom-logstash-exporter/pkg/relabel"
+)
+
+// TestKeepDropWithoutSourceLabels matches the regex of keep and drop rules
+// without source_labels against the empty string, like Prometheus does.
+func TestKeepDropWithoutSourceLabels(t *testing.T) {
+	for _, test := range []struct {
+		config string
+		kept   bool
+	}{
+		{"{action: keep, regex: ''}", true},
+		{"{action: keep, regex: '.+'}", false},
+		{"{action: drop, regex: ''}", false},
+		{"{action: drop}", false},
+		{"{action: drop, regex: '.+'}", true},
+	} {
+		var config relabel.Config
+		if err := yaml.Unmarshal([]byte(test.config), &config); err != nil {
+			t.Errorf("%s: %v", test.config, err)
+			continue
+		}
+		labels := map[string]string{"__name__": "logstash_up"}
+		if kept := relabel.Process(labels, &config); kept != test.kept {
+			t.Errorf("%s kept the series: %v, want %v", test.config, kept, test.kept)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package relabel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// Gatherer applies relabeling rules to the metrics gathered by another
+// Gatherer. Series whose __name__ is rewritten move to the family of that name,
+// keeping the type and help of their original family.
+//
+// Like in Prometheus, the _sum and _count series of a summary can be relabeled
+// on their own: when the rules rename them but not the summary, they are
+// exposed as two counters of their new names, without the quantiles.
+type Gatherer struct {
+	Gatherer prometheus.Gatherer
+	Configs  []*Config
+}
+
+// Summary series relabeled on their own.
+var summaryComponents = []struct {
+	suffix string
+	value  func(*dto.Summary) float64
+}{
+	{"_sum", func(s *dto.Summary) float64 { return s.GetSampleSum() }},
+	{"_count", func(s *dto.Summary) float64 { return float64(s.GetSampleCount()) }},
+}
+
+func (g *Gatherer) Gather() ([]*dto.MetricFamily, error) {
+	gathered, err := g.Gatherer.Gather()
+	r := relabeled{families: make(map[string]*dto.MetricFamily), seen: make(map[string]struct{})}
+	if err != nil {
+		r.errs.Append(err)
+	}
+
+	for _, family := range gathered {
+		for _, metric := range family.Metric {
+			if family.GetType() == dto.MetricType_SUMMARY && g.summaryComponentsRenamed(family.GetName(), metric) {
+				for _, component := range summaryComponents {
+					labels := metricLabels(metric, family.GetName()+component.suffix)
+					if !Process(labels, g.Configs...) {
+						continue
+					}
+					counter := &dto.Metric{Counter: &dto.Counter{Value: proto.Float64(component.value(metric.GetSummary()))}, TimestampMs: metric.TimestampMs}
+					r.add(family.GetName(), family.Help, dto.MetricType_COUNTER, labels, counter)
+				}
+				continue
+			}
+
+			labels := metricLabels(metric, family.GetName())
+			if !Process(labels, g.Configs...) {
+				continue
+			}
+			r.add(family.GetName(), family.Help, family.GetType(), labels, proto.Clone(metric).(*dto.Metric))
+		}
+	}
+
+	return r.result(), r.errs.MaybeUnwrap()
+}
+
+// summaryComponentsRenamed reports whether the rules rename the _sum or _count
+// series of the summary metric of the family name, but not the summary itself.
+func (g *Gatherer) summaryComponentsRenamed(name string, metric *dto.Metric) bool {
+	labels := metricLabels(metric, name)
+	if !Process(labels, g.Configs...) || labels[model.MetricNameLabel] != name {
+		return false
+	}
+
+	for _, component := range summaryComponents {
+		labels := metricLabels(metric, name+component.suffix)
+		if Process(labels, g.Configs...) && labels[model.MetricNameLabel] != name+component.suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// metricLabels returns the labels of metric, its __name__ being name.
+func metricLabels(metric *dto.Metric, name string) map[string]string {
+	labels := make(map[string]string, len(metric.Label)+1)
+	for _, pair := range metric.Label {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	labels[model.MetricNameLabel] = name
+	return labels
+}
+
+// relabeled collects the relabeled series into families.
+type relabeled struct {
+	families map[string]*dto.MetricFamily
+	seen     map[string]struct{}
+	errs     prometheus.MultiError
+}
+
+// add adds metric, relabeled from the family source, to the family named by
+// the __name__ of labels, the other labels replacing those of metric.
+func (r *relabeled) add(source string, help *string, metricType dto.MetricType, labels map[string]string, metric *dto.Metric) {
+	name := labels[model.MetricNameLabel]
+	delete(labels, model.MetricNameLabel)
+	if !model.IsValidMetricName(model.LabelValue(name)) {
+		r.errs.Append(fmt.Errorf("relabeling %s produced the invalid metric name %q", source, name))
+		return
+	}
+
+	target, ok := r.families[name]
+	if !ok {
+		target = &dto.MetricFamily{Name: proto.String(name), Help: help, Type: metricType.Enum()}
+		r.families[name] = target
+	} else if target.GetType() != metricType {
+		r.errs.Append(fmt.Errorf("relabeling %s into %s mixes %s and %s metrics", source, name, metricType, target.GetType()))
+		return
+	}
+
+	metric.Label = labelPairs(labels)
+
+	signature := name + labelsSignature(metric.Label)
+	if _, duplicate := r.seen[signature]; duplicate {
+		r.errs.Append(fmt.Errorf("relabeling %s produced the duplicate series %s", source, signature))
+		return
+	}
+	r.seen[signature] = struct{}{}
+
+	target.Metric = append(target.Metric, metric)
+}
+
+// result returns the families sorted by name.
+func (r *relabeled) result() []*dto.MetricFamily {
+	result := make([]*dto.MetricFamily, 0, len(r.families))
+	for _, family := range r.families {
+		result = append(result, family)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result
+}
+
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].GetName() < pairs[j].GetName()
+	})
+	return pairs
+}
+
+func labelsSignature(pairs []*dto.LabelPair) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, pair := range pairs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", pair.GetName(), pair.GetValue())
+	}
+	b.WriteByte('}')
+	return b.String()
+}
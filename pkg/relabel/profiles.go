@@ -0,0 +1,186 @@
+package relabel
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/prometheus/common/model"
+	"prom-logstash-exporter/pkg/helpers"
+)
+
+// Names of the metric naming profiles.
+const (
+	ProfileNative      = "native"
+	ProfileBonnierNews = "bonniernews"
+	ProfileKuskoman    = "kuskoman"
+)
+
+// pluginSeries matches the input, filter and output plugin families, capturing the plugin type.
+const pluginSeries = "logstash_pipeline_(input|filter|output)_.*"
+
+// profiles maps the metric names of this exporter to the names used by other
+// Logstash exporters, whether legacy metric names are enabled or not. The GC
+// summary is mapped through its _sum and _count series. Families whose unit
+// differs (durations in milliseconds, percentages) are not mapped and keep
+// their name.
+var profiles = map[string][]*Config{
+	ProfileNative: nil,
+	ProfileBonnierNews: concat(
+		nativeNames(),
+		pluginLabels("plugin_type", "plugin_id", "plugin"),
+		renames(map[string]string{
+			"logstash_up":                                               "logstash_node_up",
+			"logstash_jvm_threads":                                      "logstash_node_jvm_threads_count",
+			"logstash_jvm_heap_committed_bytes":                         "logstash_node_mem_heap_committed_bytes",
+			"logstash_jvm_heap_used_bytes":                              "logstash_node_mem_heap_used_bytes",
+			"logstash_jvm_memory_pool_committed_bytes":                  "logstash_node_mem_pool_committed_bytes",
+			"logstash_jvm_memory_pool_max_bytes":                        "logstash_node_mem_pool_max_bytes",
+			"logstash_jvm_memory_pool_used_bytes":                       "logstash_node_mem_pool_used_bytes",
+			"logstash_jvm_gc_collection_duration_seconds_sum":           "logstash_node_gc_collection_duration_seconds_total",
+			"logstash_jvm_gc_collection_duration_seconds_count":         "logstash_node_gc_collection_total",
+			"logstash_process_open_file_descriptors":                    "logstash_node_process_open_filedescriptors",
+			"logstash_process_max_file_descriptors":                     "logstash_node_process_max_filedescriptors",
+			"logstash_process_cpu_seconds_total":                        "logstash_node_process_cpu_total_seconds_total",
+			"logstash_process_total_virtual_memory_bytes":               "logstash_node_process_mem_total_virtual_bytes",
+			"logstash_pipeline_event_in_total":                          "logstash_node_pipeline_events_in_total",
+			"logstash_pipeline_event_filtered_total":                    "logstash_node_pipeline_events_filtered_total",
+			"logstash_pipeline_event_out_total":                         "logstash_node_pipeline_events_out_total",
+			"logstash_pipeline_event_duration_seconds_total":            "logstash_node_pipeline_duration_seconds_total",
+			"logstash_pipeline_event_queue_push_duration_seconds_total": "logstash_node_pipeline_queue_push_duration_seconds_total",
+			"logstash_pipeline_queue_events":                            "logstash_node_pipeline_queue_events_count",
+			"logstash_pipeline_queue_max_size_bytes":                    "logstash_node_pipeline_queue_max_queue_size_bytes",
+			"logstash_pipeline_capacity_max_unread_events":              "logstash_node_pipeline_queue_max_unread_events",
+			"logstash_pipeline_page_capacity_bytes":                     "logstash_node_pipeline_queue_page_capacity_bytes",
+			"logstash_pipeline_dead_letter_queue_size_bytes":            "logstash_node_dead_letter_queue_size_bytes",
+			"logstash_reloads_config_successes_total":                   "logstash_node_pipeline_reloads_successes_total",
+			"logstash_reloads_config_failures_total":                    "logstash_node_pipeline_reloads_failures_total",
+			"logstash_pipeline_input_in_total":                          "logstash_node_plugin_events_in_total",
+			"logstash_pipeline_filter_in_total":                         "logstash_node_plugin_events_in_total",
+			"logstash_pipeline_output_in_total":                         "logstash_node_plugin_events_in_total",
+			"logstash_pipeline_input_out_total":                         "logstash_node_plugin_events_out_total",
+			"logstash_pipeline_filter_out_total":                        "logstash_node_plugin_events_out_total",
+			"logstash_pipeline_output_out_total":                        "logstash_node_plugin_events_out_total",
+			"logstash_pipeline_filter_duration_seconds_total":           "logstash_node_plugin_duration_seconds_total",
+			"logstash_pipeline_output_duration_seconds_total":           "logstash_node_plugin_duration_seconds_total",
+			"logstash_pipeline_input_queue_push_seconds_total":          "logstash_node_plugin_queue_push_duration_seconds_total",
+		}),
+	),
+	ProfileKuskoman: concat(
+		nativeNames(),
+		pluginLabels("plugin_type", "plugin_id", "plugin"),
+		renames(map[string]string{
+			"logstash_up":                                           "logstash_info_up",
+			"logstash_pipeline_config_workers":                      "logstash_info_pipeline_workers",
+			"logstash_pipeline_config_batch_size":                   "logstash_info_pipeline_batch_size",
+			"logstash_jvm_threads":                                  "logstash_stats_jvm_threads_count",
+			"logstash_jvm_heap_committed_bytes":                     "logstash_stats_jvm_mem_heap_committed_bytes",
+			"logstash_jvm_heap_used_bytes":                          "logstash_stats_jvm_mem_heap_used_bytes",
+			"logstash_jvm_memory_pool_committed_bytes":              "logstash_stats_jvm_mem_pool_committed_bytes",
+			"logstash_jvm_memory_pool_max_bytes":                    "logstash_stats_jvm_mem_pool_max_bytes",
+			"logstash_jvm_memory_pool_used_bytes":                   "logstash_stats_jvm_mem_pool_used_bytes",
+			"logstash_process_open_file_descriptors":                "logstash_stats_process_open_filedescriptors",
+			"logstash_process_max_file_descriptors":                 "logstash_stats_process_max_filedescriptors",
+			"logstash_process_total_virtual_memory_bytes":           "logstash_stats_process_mem_total_virtual",
+			"logstash_event_in_total":                               "logstash_stats_events_in",
+			"logstash_event_filtered_total":                         "logstash_stats_events_filtered",
+			"logstash_event_out_total":                              "logstash_stats_events_out",
+			"logstash_pipeline_event_in_total":                      "logstash_stats_pipeline_events_in",
+			"logstash_pipeline_event_filtered_total":                "logstash_stats_pipeline_events_filtered",
+			"logstash_pipeline_event_out_total":                     "logstash_stats_pipeline_events_out",
+			"logstash_pipeline_queue_events":                        "logstash_stats_pipeline_queue_events_count",
+			"logstash_pipeline_queue_size_bytes":                    "logstash_stats_pipeline_queue_events_queue_size",
+			"logstash_pipeline_queue_max_size_bytes":                "logstash_stats_pipeline_queue_max_size_in_bytes",
+			"logstash_pipeline_dead_letter_queue_size_bytes":        "logstash_stats_pipeline_dead_letter_queue_queue_size_in_bytes",
+			"logstash_reloads_config_successes_total":               "logstash_stats_reloads_successes",
+			"logstash_reloads_config_failures_total":                "logstash_stats_reloads_failures",
+			"logstash_pipeline_input_in_total":                      "logstash_stats_pipeline_plugin_events_in",
+			"logstash_pipeline_filter_in_total":                     "logstash_stats_pipeline_plugin_events_in",
+			"logstash_pipeline_output_in_total":                     "logstash_stats_pipeline_plugin_events_in",
+			"logstash_pipeline_input_out_total":                     "logstash_stats_pipeline_plugin_events_out",
+			"logstash_pipeline_filter_out_total":                    "logstash_stats_pipeline_plugin_events_out",
+			"logstash_pipeline_output_out_total":                    "logstash_stats_pipeline_plugin_events_out",
+			"logstash_pipeline_output_successes_total":              "logstash_stats_pipeline_plugin_documents_successes",
+			"logstash_pipeline_output_non_retryable_failures_total": "logstash_stats_pipeline_plugin_documents_non_retryable_failures",
+		}),
+	),
+}
+
+// ProfileNames lists the available naming profiles.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the relabeling rules of the named naming profile.
+func Profile(name string) ([]*Config, error) {
+	configs, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown metrics profile %q, expected one of %v", name, ProfileNames())
+	}
+	return append([]*Config(nil), configs...), nil
+}
+
+// nativeNames returns the rules giving back their current name to the families
+// exported with their legacy name, so that profiles apply to both namings.
+func nativeNames() []*Config {
+	names := make(map[string]string)
+	for name, legacyName := range helpers.LegacyNames() {
+		names[legacyName] = name
+	}
+	return renames(names)
+}
+
+// renames returns the rules renaming the families of names, in a stable order.
+func renames(names map[string]string) []*Config {
+	from := make([]string, 0, len(names))
+	for name := range names {
+		from = append(from, name)
+	}
+	sort.Strings(from)
+
+	configs := make([]*Config, 0, len(names))
+	for _, name := range from {
+		configs = append(configs, replace([]string{model.MetricNameLabel}, regexp.QuoteMeta(name), model.MetricNameLabel, names[name]))
+	}
+	return configs
+}
+
+// pluginLabels returns the rules labeling the plugin series with their type and
+// moving their id and name labels to idLabel and nameLabel.
+func pluginLabels(typeLabel, idLabel, nameLabel string) []*Config {
+	return []*Config{
+		replace([]string{model.MetricNameLabel}, pluginSeries, typeLabel, "$1"),
+		replace([]string{model.MetricNameLabel, "id"}, pluginSeries+";(.*)", idLabel, "$2"),
+		replace([]string{model.MetricNameLabel, "name"}, pluginSeries+";(.*)", nameLabel, "$2"),
+		replace([]string{model.MetricNameLabel}, pluginSeries, "id", ""),
+		replace([]string{model.MetricNameLabel}, pluginSeries, "name", ""),
+	}
+}
+
+func replace(sourceLabels []string, regex, targetLabel, replacement string) *Config {
+	re, err := NewRegexp(regex)
+	if err != nil {
+		panic(err)
+	}
+	return &Config{
+		SourceLabels: sourceLabels,
+		Separator:    ";",
+		Regex:        re,
+		TargetLabel:  targetLabel,
+		Replacement:  replacement,
+		Action:       Replace,
+	}
+}
+
+func concat(configs ...[]*Config) []*Config {
+	var all []*Config
+	for _, c := range configs {
+		all = append(all, c...)
+	}
+	return all
+}
@@ -0,0 +1,104 @@
+package relabel_test
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"prom-logstash-exporter/pkg/collector"
+	"prom-logstash-exporter/pkg/collector/node_stats"
+	"prom-logstash-exporter/pkg/relabel"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// gatherProfile returns the exposition of the node_stats.json fixture with the
+// metrics profile applied. The exporter metrics are left out as they hold
+// durations.
+func gatherProfile(t *testing.T, profile string, legacyMetricNames bool) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../collector/node_stats/testdata/node_stats.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	c, err := collector.NewLogstashCollector(server.URL, collector.Options{
+		Pipelines:         node_stats.PipelinesCollectorOptions{PluginMetrics: true},
+		LegacyMetricNames: legacyMetricNames,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	withoutExporterMetrics := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := registry.Gather()
+		kept := families[:0]
+		for _, family := range families {
+			if !strings.HasPrefix(family.GetName(), "logstash_exporter_") {
+				kept = append(kept, family)
+			}
+		}
+		return kept, err
+	})
+
+	configs, err := relabel.Profile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	families, err := (&relabel.Gatherer{Gatherer: withoutExporterMetrics, Configs: configs}).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&b, family); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestProfiles(t *testing.T) {
+	for _, profile := range relabel.ProfileNames() {
+		profile := profile
+		t.Run(profile, func(t *testing.T) {
+			golden := "testdata/" + profile + ".prom"
+			got := gatherProfile(t, profile, false)
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("profile %s does not match %s, run go test -update to update it:\n%s", profile, golden, got)
+			}
+
+			if profile == relabel.ProfileNative {
+				return
+			}
+			if legacy := gatherProfile(t, profile, true); !bytes.Equal(legacy, want) {
+				t.Errorf("profile %s with legacy metric names does not match %s:\n%s", profile, golden, legacy)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Process applies configs in order to labels, the metric name being the
+// __name__ label. It returns false when the series is dropped, labels being
+// modified in place otherwise.
+func Process(labels map[string]string, configs ...*Config) bool {
+	for _, config := range configs {
+		if !apply(labels, config) {
+			return false
+		}
+	}
+	return true
+}
+
+func apply(labels map[string]string, config *Config) bool {
+	values := make([]string, 0, len(config.SourceLabels))
+	for _, name := range config.SourceLabels {
+		values = append(values, labels[name])
+	}
+	value := strings.Join(values, config.Separator)
+
+	switch config.Action {
+	case Drop:
+		if config.Regex.MatchString(value) {
+			return false
+		}
+	case Keep:
+		if !config.Regex.MatchString(value) {
+			return false
+		}
+	case Replace:
+		indexes := config.Regex.FindStringSubmatchIndex(value)
+		if indexes == nil {
+			break
+		}
+		target := string(config.Regex.ExpandString(nil, config.TargetLabel, value, indexes))
+		if !model.LabelName(target).IsValid() {
+			break
+		}
+		replacement := config.Regex.ExpandString(nil, config.Replacement, value, indexes)
+		if len(replacement) == 0 {
+			delete(labels, target)
+			break
+		}
+		labels[target] = string(replacement)
+	case HashMod:
+		sum := md5.Sum([]byte(value))
+		labels[config.TargetLabel] = strconv.FormatUint(binary.BigEndian.Uint64(sum[8:])%config.Modulus, 10)
+	case LabelMap:
+		mapped := make(map[string]string)
+		for name, value := range labels {
+			if config.Regex.MatchString(name) {
+				mapped[config.Regex.ReplaceAllString(name, config.Replacement)] = value
+			}
+		}
+		for name, value := range mapped {
+			labels[name] = value
+		}
+	case LabelDrop, LabelKeep:
+		for name := range labels {
+			if config.Regex.MatchString(name) == (config.Action == LabelDrop) {
+				delete(labels, name)
+			}
+		}
+	}
+	return true
+}
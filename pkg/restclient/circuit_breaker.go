@@ -0,0 +1,67 @@
+package restclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitBreaker short-circuits the requests of Handler once Threshold consecutive
+// requests failed, so a target known to be down is not queried again until Cooldown
+// elapsed. The first request after the cooldown is let through: its success closes
+// the circuit, its failure opens it for another cooldown.
+type CircuitBreaker struct {
+	Handler   HTTPHandlerInterface
+	Threshold int
+	Cooldown  time.Duration
+	// OnStateChange is called whenever the circuit opens or closes.
+	OnStateChange func(open bool)
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	open      bool
+}
+
+func (b *CircuitBreaker) Get(ctx context.Context, path string) (*http.Response, error) {
+	if until, ok := b.shortCircuit(); ok {
+		return nil, &Error{
+			Reason: ReasonCircuitOpen,
+			Err:    fmt.Errorf("circuit breaker open until %s after %d consecutive failures", until.Format(time.RFC3339), b.Threshold),
+		}
+	}
+
+	response, err := b.Handler.Get(ctx, path)
+	b.record(err == nil)
+	return response, err
+}
+
+func (b *CircuitBreaker) shortCircuit() (time.Time, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.openUntil, b.open && time.Now().Before(b.openUntil)
+}
+
+func (b *CircuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	wasOpen := b.open
+	if success {
+		b.failures = 0
+		b.open = false
+	} else {
+		b.failures++
+		if b.open || b.failures >= b.Threshold {
+			b.open = true
+			b.openUntil = time.Now().Add(b.Cooldown)
+		}
+	}
+
+	if wasOpen != b.open && b.OnStateChange != nil {
+		b.OnStateChange(b.open)
+	}
+}
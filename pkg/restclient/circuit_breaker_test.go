@@ -0,0 +1,84 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// get sends a request through b, returning the reason of its error, "" on success.
+func get(t *testing.T, b *CircuitBreaker) string {
+	t.Helper()
+	response, err := b.Get(context.Background(), "/")
+	if err != nil {
+		var restErr *Error
+		if !errors.As(err, &restErr) {
+			t.Fatalf("unclassified error %v", err)
+		}
+		return restErr.Reason
+	}
+	response.Body.Close()
+	return ""
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	fake := &fakeHandler{errs: []error{errConnect, nil, errConnect, errConnect, errConnect, nil, errConnect, nil}}
+	var states []bool
+	b := &CircuitBreaker{
+		Handler:       fake,
+		Threshold:     2,
+		Cooldown:      cooldown,
+		OnStateChange: func(open bool) { states = append(states, open) },
+	}
+
+	// A success resets the count of consecutive failures.
+	for i, want := range []string{ReasonConnect, "", ReasonConnect} {
+		if got := get(t, b); got != want {
+			t.Fatalf("request %d: reason %q, want %q", i, got, want)
+		}
+	}
+	if len(states) != 0 {
+		t.Fatalf("circuit state changed to %v below the threshold", states)
+	}
+
+	// The second consecutive failure opens the circuit: the requests are no
+	// longer sent until the cooldown elapsed.
+	if got := get(t, b); got != ReasonConnect {
+		t.Fatalf("reason %q, want %q", got, ReasonConnect)
+	}
+	if got := get(t, b); got != ReasonCircuitOpen {
+		t.Fatalf("request to an open circuit: reason %q, want %q", got, ReasonCircuitOpen)
+	}
+	if n := len(fake.callTimes()); n != 4 {
+		t.Fatalf("%d requests sent, want 4", n)
+	}
+
+	// Half-open: the first request after the cooldown is sent, and its failure
+	// opens the circuit for another cooldown.
+	time.Sleep(cooldown)
+	if got := get(t, b); got != ReasonConnect {
+		t.Fatalf("request after the cooldown: reason %q, want %q", got, ReasonConnect)
+	}
+	if got := get(t, b); got != ReasonCircuitOpen {
+		t.Fatalf("request after a half-open failure: reason %q, want %q", got, ReasonCircuitOpen)
+	}
+
+	// The success of the half-open request closes the circuit, and a single
+	// failure no longer opens it.
+	time.Sleep(cooldown)
+	for i, want := range []string{"", ReasonConnect, ""} {
+		if got := get(t, b); got != want {
+			t.Fatalf("request %d after closing: reason %q, want %q", i, got, want)
+		}
+	}
+
+	if want := []bool{true, false}; !reflect.DeepEqual(states, want) {
+		t.Errorf("circuit states = %v, want %v", states, want)
+	}
+	if n := len(fake.callTimes()); n != 8 {
+		t.Errorf("%d requests sent, want 8", n)
+	}
+}
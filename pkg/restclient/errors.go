@@ -0,0 +1,76 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Reasons a request to Logstash can fail with.
+const (
+	ReasonConnect     = "connect"
+	ReasonTimeout     = "timeout"
+	ReasonHTTPStatus  = "http_status"
+	ReasonDecode      = "decode"
+	ReasonAuth        = "auth"
+	ReasonCircuitOpen = "circuit_open"
+)
+
+// ErrorReasons lists every reason an Error can be classified with.
+var ErrorReasons = []string{ReasonConnect, ReasonTimeout, ReasonHTTPStatus, ReasonDecode, ReasonAuth, ReasonCircuitOpen}
+
+// Error is returned by the restclient when a request to Logstash fails.
+type Error struct {
+	// Reason classifies the failure, see ErrorReasons.
+	Reason string
+	// StatusCode is the HTTP status code returned by Logstash, or 0 when no response was received.
+	StatusCode int
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newRequestError(endpoint string, err error) *Error {
+	return &Error{
+		Reason: transportErrorReason(err),
+		Err:    fmt.Errorf("failed to GET %s: %w", endpoint, err),
+	}
+}
+
+// transportErrorReason classifies an error returned while talking to Logstash as a timeout or a connection failure.
+func transportErrorReason(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ReasonTimeout
+	}
+	return ReasonConnect
+}
+
+func newStatusError(endpoint string, statusCode int) *Error {
+	reason := ReasonHTTPStatus
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		reason = ReasonAuth
+	}
+
+	return &Error{
+		Reason:     reason,
+		StatusCode: statusCode,
+		Err:        fmt.Errorf("GET %s returned status code %d", endpoint, statusCode),
+	}
+}
+
+func newDecodeError(statusCode int, err error) *Error {
+	return &Error{
+		Reason:     ReasonDecode,
+		StatusCode: statusCode,
+		Err:        fmt.Errorf("failed to decode metrics data: %w", err),
+	}
+}
@@ -1,50 +1,199 @@
 package restclient
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// maxDrainBytes bounds how much of an unread response body is consumed so the
+// underlying connection can be reused.
+const maxDrainBytes = 64 << 10
+
+// bufferPool holds the buffers response bodies are copied into while they are
+// decoded, for the PartialUnmarshaler targets, so the multi-megabyte node stats
+// documents of large deployments do not grow a new buffer every scrape.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
 type HTTPHandler struct {
+	// Endpoint is the base URL of the Logstash API the request paths are appended to.
 	Endpoint string
+	// Client performs the requests, http.DefaultClient when nil.
+	Client *http.Client
+	// OnConnection is called with whether each request reused a pooled connection.
+	OnConnection func(reused bool)
+}
+
+// NewHTTPClient returns a client dedicated to a single Logstash target, keeping
+// its connections alive between scrapes. Responses are requested gzip-compressed
+// and transparently decompressed by the transport.
+func NewHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          4,
+			MaxIdleConnsPerHost:   4,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			DisableCompression:    false,
+		},
+	}
 }
 
-func (h *HTTPHandler) Get() (*http.Response, error) {
-	response, err := http.Get(h.Endpoint)
+func (h *HTTPHandler) Get(ctx context.Context, path string) (*http.Response, error) {
+	if h.OnConnection != nil {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				h.OnConnection(info.Reused)
+			},
+		})
+	}
+
+	url := h.Endpoint + path
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to GET %s: %v", h.Endpoint, err)
+		return nil, &Error{Reason: ReasonConnect, Err: fmt.Errorf("failed to create request for %s: %w", url, err)}
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, newRequestError(url, err)
 	}
 
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GET %s returned status code %d", h.Endpoint, response.StatusCode)
+		closeBody(response.Body)
+		return nil, newStatusError(url, response.StatusCode)
 	}
 
 	return response, nil
 }
 
+// closeBody drains and closes body so the connection goes back to the pool.
+func closeBody(body io.ReadCloser) {
+	if _, err := io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes)); err != nil {
+		logrus.WithError(err).Debugln("Error draining response body")
+	}
+	if err := body.Close(); err != nil {
+		logrus.WithError(err).Warnln("Error closing response body")
+	}
+}
+
 type HTTPHandlerInterface interface {
-	Get() (*http.Response, error)
+	Get(ctx context.Context, path string) (*http.Response, error)
+}
+
+// ResponseStats describes the retrieval of a JSON document by GetMetricsWithStats.
+type ResponseStats struct {
+	// Size is the size in bytes of the decompressed response body.
+	Size int
+	// DecodeDuration is the time spent reading and decoding the body, which is
+	// decoded as it is read.
+	DecodeDuration time.Duration
+	// Skipped describes the parts of the body a PartialUnmarshaler target left
+	// out because they held values of unexpected types.
+	Skipped []error
 }
 
-func GetMetrics(h HTTPHandlerInterface, target interface{}) error {
-	response, err := h.Get()
+// PartialUnmarshaler is implemented by the targets of GetMetrics able to decode
+// a document holding values of unexpected types, leaving out the parts holding
+// them instead of failing. It is only used once decoding the whole document
+// failed, so it does not slow down decoding valid documents.
+type PartialUnmarshaler interface {
+	// UnmarshalPartial decodes data, returning the errors of the parts left out.
+	UnmarshalPartial(data []byte) (skipped []error, err error)
+}
+
+// GetMetrics retrieves the JSON document served by h at path and decodes it into target.
+// Failures are reported as an *Error classifying their reason.
+func GetMetrics(ctx context.Context, h HTTPHandlerInterface, path string, target interface{}) error {
+	_, err := GetMetricsWithStats(ctx, h, path, target)
+	return err
+}
+
+// GetMetricsWithStats is GetMetrics also reporting the size of the response and
+// how long decoding it took, the stats being zero when no body was read.
+func GetMetricsWithStats(ctx context.Context, h HTTPHandlerInterface, path string, target interface{}) (ResponseStats, error) {
+	var stats ResponseStats
+
+	response, err := h.Get(ctx, path)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve metrics data: %v", err)
-	}
-	defer func() {
-		if closeErr := response.Body.Close(); closeErr != nil {
-			logrus.Printf("Error closing response body: %v", closeErr)
+		var restErr *Error
+		if errors.As(err, &restErr) {
+			return stats, err
 		}
-	}()
+		return stats, &Error{Reason: ReasonConnect, Err: fmt.Errorf("failed to retrieve metrics data: %w", err)}
+	}
+	defer closeBody(response.Body)
+
+	body := &countingReader{reader: response.Body}
+	var reader io.Reader = body
+	partial, isPartial := target.(PartialUnmarshaler)
+	var buffer *bytes.Buffer
+	if isPartial {
+		// The body is kept to decode it again should it hold values of unexpected types.
+		buffer = bufferPool.Get().(*bytes.Buffer)
+		defer func() {
+			buffer.Reset()
+			bufferPool.Put(buffer)
+		}()
+		reader = io.TeeReader(body, buffer)
+	}
 
-	if err := json.NewDecoder(response.Body).Decode(target); err != nil {
-		return fmt.Errorf("failed to decode metrics data: %v", err)
+	start := time.Now()
+	err = json.NewDecoder(reader).Decode(target)
+	var typeErr *json.UnmarshalTypeError
+	if isPartial && errors.As(err, &typeErr) {
+		stats.Skipped, err = partial.UnmarshalPartial(buffer.Bytes())
 	}
+	stats.DecodeDuration = time.Since(start)
+	stats.Size = body.size
 
-	logrus.Println("Successfully retrieved and decoded metrics data at.", time.Now())
-	return nil
+	if body.err != nil {
+		return stats, &Error{Reason: transportErrorReason(body.err), StatusCode: response.StatusCode, Err: fmt.Errorf("failed to read metrics data: %w", body.err)}
+	}
+	if err != nil {
+		return stats, newDecodeError(response.StatusCode, err)
+	}
+
+	return stats, nil
+}
+
+// countingReader counts the bytes read from reader and records its read error.
+type countingReader struct {
+	reader io.Reader
+	size   int
+	err    error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.size += n
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
 }
@@ -1,6 +1,9 @@
 package restclient
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 type NodeInfoRes struct {
 	Host        string `json:"host"`
@@ -56,12 +59,12 @@ func NodeInfo(endpoint string) (NodeInfoRes, error) {
 	var response NodeInfoRes
 
 	handler := &HTTPHandler{
-		Endpoint: fmt.Sprintf("%s/_node/", endpoint),
+		Endpoint: endpoint,
 	}
 
-	err := GetMetrics(handler, &response)
+	err := GetMetrics(context.Background(), handler, "/_node/", &response)
 	if err != nil {
-		return NodeInfoRes{}, fmt.Errorf("failed to retrieve node info: %v", err)
+		return NodeInfoRes{}, fmt.Errorf("failed to retrieve node info: %w", err)
 	}
 
 	return response, nil
@@ -0,0 +1,69 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryHandler retries the requests of Handler that failed with a transient error
+// (connection failure, timeout or 5xx status) with a jittered exponential backoff,
+// as long as the deadline of the request context allows it.
+type RetryHandler struct {
+	Handler HTTPHandlerInterface
+	// Attempts is the maximum number of retries after the first attempt.
+	Attempts int
+	// Backoff is the base delay before the first retry, doubled on every retry.
+	Backoff time.Duration
+	// OnRetry is called before every retry with the error of the failed attempt.
+	OnRetry func(err error)
+}
+
+func (h *RetryHandler) Get(ctx context.Context, path string) (*http.Response, error) {
+	response, err := h.Handler.Get(ctx, path)
+	for attempt := 0; err != nil && attempt < h.Attempts && retryable(err); attempt++ {
+		delay := jitter(h.Backoff << attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+
+		if h.OnRetry != nil {
+			h.OnRetry(err)
+		}
+		response, err = h.Handler.Get(ctx, path)
+	}
+
+	return response, err
+}
+
+func retryable(err error) bool {
+	var restErr *Error
+	if !errors.As(err, &restErr) {
+		return false
+	}
+
+	switch restErr.Reason {
+	case ReasonConnect, ReasonTimeout:
+		return true
+	case ReasonHTTPStatus:
+		return restErr.StatusCode >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
+
+// jitter returns a random duration in [d/2, d].
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
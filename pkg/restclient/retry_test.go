@@ -0,0 +1,151 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHandler fails its requests with errs in order, repeating the last one,
+// a nil error being a successful response. It records when it is called.
+type fakeHandler struct {
+	errs []error
+
+	mutex sync.Mutex
+	calls []time.Time
+}
+
+func (h *fakeHandler) Get(ctx context.Context, path string) (*http.Response, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	err := h.errs[len(h.errs)-1]
+	if len(h.calls) < len(h.errs) {
+		err = h.errs[len(h.calls)]
+	}
+	h.calls = append(h.calls, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+}
+
+func (h *fakeHandler) callTimes() []time.Time {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]time.Time(nil), h.calls...)
+}
+
+var errConnect = &Error{Reason: ReasonConnect, Err: errors.New("connection refused")}
+
+func TestRetryHandlerBackoff(t *testing.T) {
+	const backoff = 20 * time.Millisecond
+	fake := &fakeHandler{errs: []error{errConnect}}
+	var retried []error
+	h := &RetryHandler{
+		Handler:  fake,
+		Attempts: 3,
+		Backoff:  backoff,
+		OnRetry:  func(err error) { retried = append(retried, err) },
+	}
+
+	if _, err := h.Get(context.Background(), "/"); err != errConnect {
+		t.Errorf("error = %v, want the error of the last attempt", err)
+	}
+	calls := fake.callTimes()
+	if len(calls) != 4 {
+		t.Fatalf("%d requests, want the first attempt and 3 retries", len(calls))
+	}
+	if len(retried) != 3 {
+		t.Errorf("OnRetry called %d times, want 3", len(retried))
+	}
+
+	// The delay before retry i is jittered in [backoff<<i / 2, backoff<<i].
+	for i := 1; i < len(calls); i++ {
+		delay := backoff << (i - 1)
+		if got := calls[i].Sub(calls[i-1]); got < delay/2 || got > delay+50*time.Millisecond {
+			t.Errorf("delay before retry %d = %v, want between %v and %v", i, got, delay/2, delay)
+		}
+	}
+}
+
+func TestRetryHandlerSucceeds(t *testing.T) {
+	fake := &fakeHandler{errs: []error{errConnect, newStatusError("/", http.StatusServiceUnavailable), nil}}
+	h := &RetryHandler{Handler: fake, Attempts: 5, Backoff: time.Millisecond}
+
+	response, err := h.Get(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := len(fake.callTimes()); n != 3 {
+		t.Errorf("%d requests, want no retry after the successful one", n)
+	}
+}
+
+func TestRetryHandlerNotRetried(t *testing.T) {
+	for name, err := range map[string]error{
+		"not found":    newStatusError("/", http.StatusNotFound),
+		"unauthorized": newStatusError("/", http.StatusUnauthorized),
+		"decode":       newDecodeError(http.StatusOK, errors.New("unexpected EOF")),
+		"unclassified": errors.New("unclassified"),
+	} {
+		fake := &fakeHandler{errs: []error{err}}
+		h := &RetryHandler{Handler: fake, Attempts: 3, Backoff: time.Millisecond}
+		if _, got := h.Get(context.Background(), "/"); got != err {
+			t.Errorf("%s: error = %v, want %v", name, got, err)
+		}
+		if n := len(fake.callTimes()); n != 1 {
+			t.Errorf("%s: %d requests, want no retry", name, n)
+		}
+	}
+}
+
+func TestRetryHandlerContext(t *testing.T) {
+	// The context is canceled while waiting for the retry.
+	fake := &fakeHandler{errs: []error{errConnect}}
+	h := &RetryHandler{Handler: fake, Attempts: 3, Backoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := h.Get(ctx, "/"); err != errConnect {
+		t.Errorf("error = %v, want %v", err, errConnect)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("canceled retry returned after %v", elapsed)
+	}
+	if n := len(fake.callTimes()); n != 1 {
+		t.Errorf("%d requests, want no retry once the context is canceled", n)
+	}
+
+	// The deadline of the context expires before the retry would be sent.
+	fake = &fakeHandler{errs: []error{errConnect}}
+	h = &RetryHandler{Handler: fake, Attempts: 3, Backoff: time.Second}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := h.Get(ctx, "/"); err != errConnect {
+		t.Errorf("error = %v, want %v", err, errConnect)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("retry past the deadline waited %v, want to give up right away", elapsed)
+	}
+	if n := len(fake.callTimes()); n != 1 {
+		t.Errorf("%d requests, want no retry past the deadline", n)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 3, 100 * time.Millisecond} {
+		for i := 0; i < 1000; i++ {
+			if got := jitter(d); got < d/2 || got > d {
+				t.Fatalf("jitter(%v) = %v, want between %v and %v", d, got, d/2, d)
+			}
+		}
+	}
+}